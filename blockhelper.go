@@ -0,0 +1,118 @@
+package template
+
+import (
+	"errors"
+	"reflect"
+)
+
+// BlockHelper renders a section that calls it, e.g. ((#each items)).
+// args are the values of the arguments of the section tag, with nil for
+// values that are missing. The helper decides if, how often and in which
+// context the body of the section is rendered.
+type BlockHelper func(body *Body, args ...interface{}) error
+
+// RegisterHelper registers a block helper. A section whose name is name
+// calls the helper instead of looking up name in the context. Helpers
+// must be registered before the template is executed.
+func (t *Template) RegisterHelper(name string, fn BlockHelper) {
+	if t.helpers == nil {
+		t.helpers = make(map[string]BlockHelper)
+	}
+	t.helpers[name] = fn
+}
+
+// helper returns the block helper that a section calls, if any.
+func (t *Template) helper(head Node) (BlockHelper, bool) {
+	id, ok := head.(*identifierNode)
+	if t == nil || !ok || len(id.path) != 1 {
+		return nil, false
+	}
+	fn, ok := t.helpers[id.path[0]]
+	return fn, ok
+}
+
+// Body is the body of a section that calls a block helper. It's only
+// valid during the call. The inverse is the else branch of the section,
+// like ((#if_eq a b))x((else))y((/if_eq)). An inverted section, like
+// ((^if_eq a b)), swaps the two.
+type Body struct {
+	s       *state
+	body    []Node
+	inverse []Node
+	err     error // Last error of rendering.
+}
+
+// Context returns the current context, which is the innermost
+// value of the context stack.
+func (b *Body) Context() interface{} {
+	v := b.s.stack[len(b.s.stack)-1]
+	if !v.IsValid() {
+		return nil
+	}
+	return v.Interface()
+}
+
+// Render renders the body with ctx pushed on the context stack.
+func (b *Body) Render(ctx interface{}) error {
+	return b.render(b.body, ctx)
+}
+
+// RenderItem renders the body for an element of a list or map, like
+// an iterating section. ctx is pushed on the context stack, key is
+// available as @key, index as @index and length as @length, and
+// @first and @last are set accordingly.
+func (b *Body) RenderItem(ctx, key interface{}, index, length int) error {
+	b.s.loops = append(b.s.loops, loop{reflect.ValueOf(key), index, length})
+	err := b.render(b.body, ctx)
+	b.s.loops = b.s.loops[:len(b.s.loops)-1]
+
+	return err
+}
+
+// Inverse renders the inverse body with ctx pushed on the context stack.
+func (b *Body) Inverse(ctx interface{}) error {
+	return b.render(b.inverse, ctx)
+}
+
+// Write writes p to the output, e.g. to write separators.
+func (b *Body) Write(p []byte) (int, error) {
+	return b.s.wr.Write(p)
+}
+
+func (b *Body) render(nodes []Node, ctx interface{}) error {
+	b.s.push(reflect.ValueOf(ctx))
+	err := b.s.walkList(nodes)
+	b.s.pop()
+
+	if err != nil {
+		b.err = err
+	}
+	return err
+}
+
+// walkHelper executes a section that calls a block helper.
+func (s *state) walkHelper(n *sectionNode, fn BlockHelper) error {
+	args := make([]interface{}, len(n.Tail))
+	for i, a := range n.Tail {
+		v, err := s.evalArg(a)
+		if err != nil {
+			return err
+		}
+		if v.IsValid() {
+			args[i] = v.Interface()
+		}
+	}
+
+	b := &Body{s: s, body: n.Children(), inverse: n.elseChildren()}
+	if n.Inverted {
+		b.body, b.inverse = b.inverse, b.body
+	}
+
+	err := fn(b, args...)
+	if err == nil || b.err != nil && errors.Is(err, b.err) {
+		// Errors of the body already tell where they happened.
+		return err
+	}
+
+	return s.errorf(n, "%s: %v", n.Name(), err)
+}
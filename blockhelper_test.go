@@ -0,0 +1,133 @@
+package template
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// testHelpers are examples of common block helpers.
+var testHelpers = map[string]BlockHelper{
+	// ((#each items))((.))((/each)) renders the body for each element,
+	// separated by commas.
+	"each": func(body *Body, args ...interface{}) error {
+		v := reflect.ValueOf(args[0])
+		if v.Kind() != reflect.Slice || v.Len() == 0 {
+			return body.Inverse(body.Context())
+		}
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				if _, err := body.Write([]byte(", ")); err != nil {
+					return err
+				}
+			}
+			if err := body.Render(v.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// ((#with user)) renders the body with user as context.
+	"with": func(body *Body, args ...interface{}) error {
+		if args[0] == nil {
+			return body.Inverse(body.Context())
+		}
+		return body.Render(args[0])
+	},
+	// ((#pairs m)) renders the body for each entry of the map m, with the
+	// value as context and the key as @key.
+	"pairs": func(body *Body, args ...interface{}) error {
+		v := reflect.ValueOf(args[0])
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		for i, k := range keys {
+			if err := body.RenderItem(v.MapIndex(k).Interface(), k.Interface(), i, len(keys)); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// ((#if_eq a b)) renders the body if a and b are equal.
+	"if_eq": func(body *Body, args ...interface{}) error {
+		if len(args) != 2 {
+			return errors.New("expected 2 arguments")
+		}
+		if fmt.Sprint(args[0]) == fmt.Sprint(args[1]) {
+			return body.Render(body.Context())
+		}
+		return body.Inverse(body.Context())
+	},
+	// ((#repeat 3)) renders the body 3 times, with the count as context.
+	"repeat": func(body *Body, args ...interface{}) error {
+		n, ok := args[0].(int64)
+		if !ok {
+			return fmt.Errorf("cannot repeat %v times", args[0])
+		}
+		for i := int64(1); i <= n; i++ {
+			if err := body.Render(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+}
+
+var helperTests = []struct {
+	name   string
+	input  string
+	result string
+	err    string
+}{
+	{"each", "((#each Users))((Name))((/each))", "Ann, Bob", ""},
+	{"each-inverse", "((^each User.Tags))no tags((/each))", "no tags", ""},
+	{"with", "((#with User))((Name)) ((Title))((/with))((#with Nope))x((/with))", "Ann Page", ""},
+	{"if-eq", `((#if_eq User.Name "Ann"))yes((/if_eq))((#if_eq Count 1))no((/if_eq))((^if_eq Count 1))inverse((/if_eq))`, "yesinverse", ""},
+	{"if-eq-else", `((#if_eq Count 1))one((else))other((/if_eq)) ((^if_eq Count 0))x((else))zero((/if_eq))`, "other zero", ""},
+	{"repeat", "((#repeat 3))((.))((/repeat))", "123", ""},
+	{"pairs", "((#pairs User.Meta))((@key))=((.))((@length))((/pairs))", "age=421", ""},
+	{"nested", "((#each Users))((#repeat 2))((Name))((/repeat))((/each))", "AnnAnn, BobBob", ""},
+	{"data-name", "((#Users))((Name))((/Users))", "AnnBob", ""},
+	{"helper-error", `((#if_eq Title))x((/if_eq))`, "", "template: helper-error:@0: if_eq: expected 2 arguments"},
+	{"body-error", `((#repeat 1))((User.Fail))((/repeat))`, "", "template: body-error:@15: User.Fail: failed"},
+}
+
+func TestBlockHelpers(t *testing.T) {
+	for _, test := range helperTests {
+		tmpl := parseTemplates(t, map[string]string{test.name: test.input})
+		for name, fn := range testHelpers {
+			tmpl.RegisterHelper(name, fn)
+		}
+
+		var buf bytes.Buffer
+		err := tmpl.Execute(&buf, test.name, execTestData)
+
+		switch {
+		case err != nil && test.err == "":
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		case err != nil && err.Error() != test.err:
+			t.Errorf("%s: got error\n\t%v\nexpected\n\t%v", test.name, err, test.err)
+		case err == nil && test.err != "":
+			t.Errorf("%s: expected error; got none", test.name)
+		case buf.String() != test.result:
+			t.Errorf("%s: got\n\t%q\nexpected\n\t%q", test.name, buf.String(), test.result)
+		}
+	}
+}
+
+func TestBlockHelperCheckTypes(t *testing.T) {
+	tmpl := parseTemplates(t, map[string]string{"a": "((#with User))((Anything))((/with))((#with Nope))((/with))"})
+	tmpl.RegisterHelper("with", testHelpers["with"])
+
+	err := tmpl.CheckTypes("a", reflect.TypeOf(execTestData))
+	if err == nil || !strings.Contains(err.Error(), `no field, method or key "Nope"`) || strings.Contains(err.Error(), "Anything") {
+		t.Errorf("got error %v, expected only Nope", err)
+	}
+
+	if err := tmpl.Generate(&bytes.Buffer{}, &GenerateOptions{Package: "views", Types: map[string]reflect.Type{"a": reflect.TypeOf("")}}); err == nil || !strings.Contains(err.Error(), "block helper with is not supported") {
+		t.Errorf("got error %v, expected unsupported block helper", err)
+	}
+}
@@ -0,0 +1,74 @@
+package template
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// parseCached parses the template src from file fn. If options has a
+// CacheDir, the tree is read from the cache when a valid entry exists
+// for the content of the file, and written to it otherwise. Entries
+// that are corrupt or were written by another version of the encoding
+// are replaced. Failures to write the cache are ignored.
+func parseCached(options *Options, fn, src string) (ParentNode, error) {
+	if options.CacheDir == "" {
+		return ParseOptions(fn, options, src)
+	}
+
+	sum := cacheKey(options, src)
+	path := filepath.Join(options.CacheDir, hex.EncodeToString(sum)+".tree")
+
+	if b, err := os.ReadFile(path); err == nil && bytes.HasPrefix(b, sum) {
+		if n, err := UnmarshalTree(b[len(sum):]); err == nil {
+			return n, nil
+		}
+	}
+
+	n, err := ParseOptions(fn, options, src)
+	if err != nil {
+		return nil, err
+	}
+
+	if b, err := MarshalTree(n); err == nil {
+		writeCache(options.CacheDir, path, append(sum, b...))
+	}
+
+	return n, nil
+}
+
+// cacheKey returns the hash of everything that determines the parsed
+// tree of src: the encoding version, the syntax and src itself.
+func cacheKey(options *Options, src string) []byte {
+	h := sha256.New()
+	h.Write([]byte(strconv.Itoa(encodeVersion) + "\x00" + options.LeftDelim + "\x00" + options.RightDelim + "\x00" + strconv.FormatBool(options.Mustache) + "\x00" + strconv.FormatBool(options.KebabCase) + "\x00"))
+	h.Write([]byte(src))
+	return h.Sum(nil)
+}
+
+// writeCache writes a cache entry to a temporary file first, so that
+// readers never see a partially written entry.
+func writeCache(dir, path string, b []byte) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+
+	f, err := os.CreateTemp(dir, ".tree-*")
+	if err != nil {
+		return
+	}
+
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
@@ -0,0 +1,596 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// checker walks a template the way state executes it, but with types
+// instead of values. A nil type is unknown (e.g. an empty interface)
+// and anything can be looked up in it.
+type checker struct {
+	t         *Template
+	name      string
+	stack     []reflect.Type
+	params    []map[string]reflect.Type
+	locals    []localType
+	overrides []map[string]block
+	visiting  map[string]bool
+	used      map[templateDep]Node // Templates that were looked up.
+	errs      []error
+}
+
+// CheckTypes checks that every identifier in the template name and in
+// the templates it includes can be resolved when the template is executed
+// with data of type typ. Sections are taken into account: a list or a
+// map pushes its element type and any other value pushes its own type.
+// Map keys cannot be checked, only the type of their values.
+func (t *Template) CheckTypes(name string, typ reflect.Type) error {
+	_, err := t.checkTypes(name, typ)
+	return err
+}
+
+// checkTypes is CheckTypes, but it also returns the templates that
+// the result depends on.
+func (t *Template) checkTypes(name string, typ reflect.Type) (map[templateDep]Node, error) {
+	c := &checker{t: t, visiting: make(map[string]bool), used: make(map[templateDep]Node)}
+	c.push(typ)
+	c.checkTemplate(nil, name, nil)
+
+	return c.used, errors.Join(c.errs...)
+}
+
+// templateDep identifies a lookup of a template by the checker.
+type templateDep struct {
+	name string
+	load bool // Looked up with getNode instead of NodeStorage.Get.
+}
+
+// lookup returns the node that dep finds in nodes, or nil
+// if the template isn't available.
+func (dep templateDep) lookup(nodes NodeStorage) Node {
+	var n Node
+	if dep.load {
+		n, _ = getNode(nodes, dep.name)
+	} else {
+		n, _ = nodes.Get(dep.name)
+	}
+	return n
+}
+
+// localType is the type of a name that is bound by a let tag.
+type localType struct {
+	name string
+	typ  reflect.Type
+}
+
+func (c *checker) errorf(node Node, format string, args ...interface{}) {
+	c.errs = append(c.errs, fmt.Errorf("template: %s:@%d: %s", c.name, node.Position(), fmt.Sprintf(format, args...)))
+}
+
+func (c *checker) push(t reflect.Type) {
+	c.pushParams(t, nil)
+}
+
+func (c *checker) pushParams(t reflect.Type, params map[string]reflect.Type) {
+	c.stack = append(c.stack, t)
+	c.params = append(c.params, params)
+}
+
+func (c *checker) pop() {
+	c.stack = c.stack[:len(c.stack)-1]
+	c.params = c.params[:len(c.params)-1]
+}
+
+func (c *checker) checkTemplate(node Node, name string, overrides []map[string]block) {
+	name, err := resolveName(c.name, name)
+	if err != nil {
+		c.errorf(node, "%v", err)
+		return
+	}
+
+	tmpl, err := getNode(c.t.nodes, name)
+	c.used[templateDep{name, true}] = tmpl
+	if err != nil {
+		if node == nil {
+			c.errs = append(c.errs, err)
+		} else {
+			c.errorf(node, "%v", err)
+		}
+		return
+	}
+
+	// Templates that include themselves only need to be checked once.
+	if c.visiting[name] {
+		return
+	}
+
+	prevName, prevOverrides, prevLocals := c.name, c.overrides, c.locals
+	c.name, c.overrides, c.locals = name, overrides, nil
+	c.visiting[name] = true
+	c.check(tmpl)
+	c.visiting[name] = false
+	c.name, c.overrides, c.locals = prevName, prevOverrides, prevLocals
+}
+
+func (c *checker) check(node Node) {
+	switch n := node.(type) {
+	case *listNode:
+		c.checkList(n.Children())
+	case *variableNode:
+		c.checkExpression(n.Head, n.Tail)
+	case *sectionNode:
+		c.checkSection(n)
+	case *letNode:
+		// A name whose value can't be resolved is unknown, so that
+		// it's only reported once.
+		typ, _ := c.checkExpression(n.Head, n.Tail)
+		c.locals = append(c.locals, localType{n.Name(), typ})
+	case *partialNode:
+		c.checkPartial(n)
+	case *inheritNode:
+		overrides := make(map[string]block)
+		for _, d := range n.Children() {
+			if d, ok := d.(*defineNode); ok {
+				overrides[d.Name()] = block{c.name, d.Children()}
+			}
+		}
+		c.checkTemplate(n, n.Name(), append(c.overrides[:len(c.overrides):len(c.overrides)], overrides))
+	case *defineNode:
+		for _, o := range c.overrides {
+			if b, ok := o[n.Name()]; ok {
+				prevName := c.name
+				c.name = b.name
+				c.checkList(b.nodes)
+				c.name = prevName
+				return
+			}
+		}
+		c.checkList(n.Children())
+	}
+}
+
+func (c *checker) checkPartial(n *partialNode) {
+	ctx, params, ok := c.checkPartialArgs(n)
+
+	if n.Dynamic != nil {
+		// The template is only known when executing.
+		c.checkIdentifier(n.Dynamic, 0)
+		return
+	}
+	if !ok {
+		return
+	}
+	if n.Optional {
+		if name, err := resolveName(c.name, n.Name()); err == nil {
+			dep := templateDep{name, false}
+			c.used[dep] = dep.lookup(c.t.nodes)
+			if c.used[dep] == nil {
+				return
+			}
+		}
+	}
+
+	if n.Context == nil && params == nil {
+		c.checkTemplate(n, n.Name(), c.overrides)
+		return
+	}
+
+	if n.Context == nil {
+		top := len(c.params) - 1
+		prev := c.params[top]
+		c.params[top] = mergeParams(prev, params)
+		c.checkTemplate(n, n.Name(), c.overrides)
+		c.params[top] = prev
+		return
+	}
+
+	c.pushParams(ctx, params)
+	c.checkTemplate(n, n.Name(), c.overrides)
+	c.pop()
+}
+
+// checkPartialArgs returns the types of the context argument and the
+// parameters of a partial, like state.partialArgs. ok is false if one
+// of them could not be resolved.
+func (c *checker) checkPartialArgs(n *partialNode) (ctx reflect.Type, params map[string]reflect.Type, ok bool) {
+	ctx, ok = c.stack[len(c.stack)-1], true
+	if n.Context != nil {
+		if ctx, ok = c.checkArg(n.Context); ok && ctx != nil && ctx.Kind() == reflect.Interface {
+			ctx = nil
+		}
+	}
+
+	for _, p := range n.Params {
+		typ, found := c.checkArg(p.Value)
+		if params == nil {
+			params = make(map[string]reflect.Type, len(n.Params))
+		}
+		params[p.Key] = typ
+		ok = ok && found
+	}
+
+	return ctx, params, ok
+}
+
+func (c *checker) checkList(nodes []Node) {
+	locals := len(c.locals)
+	for _, n := range nodes {
+		c.check(n)
+	}
+	c.locals = c.locals[:locals]
+}
+
+func (c *checker) checkSection(n *sectionNode) {
+	if _, ok := c.t.helper(n.Head); ok {
+		// Block helpers can render the body in any context.
+		for _, a := range n.Tail {
+			c.checkArg(a)
+		}
+		c.push(nil)
+		c.checkList(n.Children())
+		c.checkList(n.elseChildren())
+		c.pop()
+		return
+	}
+
+	typ, ok := c.checkExpression(n.Head, n.Tail)
+	c.checkList(n.elseChildren())
+	if !ok || n.Inverted {
+		c.checkList(n.Children())
+		return
+	}
+
+	typ = indirectType(typ)
+
+	switch {
+	case typ == nil || typ.Kind() == reflect.Interface:
+		c.push(nil)
+	case typ.Kind() == reflect.Slice || typ.Kind() == reflect.Array:
+		c.push(typ.Elem())
+	case typ.Kind() == reflect.Map && !n.PushMap:
+		c.push(typ.Elem())
+	default:
+		c.push(typ)
+	}
+
+	c.checkList(n.Children())
+	c.pop()
+}
+
+// checkExpression returns the type of an expression. ok is false
+// if the expression could not be resolved.
+func (c *checker) checkExpression(head Node, tail []Node) (typ reflect.Type, ok bool) {
+	id, isIdent := head.(*identifierNode)
+	if !isIdent {
+		return c.checkArg(head)
+	}
+
+	for _, n := range tail {
+		if _, ok := c.checkArg(n); !ok {
+			return nil, false
+		}
+	}
+
+	return c.checkIdentifier(id, len(tail))
+}
+
+func (c *checker) checkArg(node Node) (reflect.Type, bool) {
+	switch n := node.(type) {
+	case *identifierNode:
+		return c.checkIdentifier(n, 0)
+	case *stringNode:
+		return reflect.TypeOf(""), true
+	case *numberNode:
+		v, err := parseNumber(n.Text)
+		if err != nil {
+			c.errorf(n, "%v", err)
+			return nil, false
+		}
+		return reflect.TypeOf(v), true
+	case *boolNode:
+		return reflect.TypeOf(false), true
+	case *nilNode:
+		return nil, true
+	case *sliceNode:
+		return reflect.TypeOf([]interface{}(nil)), c.checkArgs(n.Items)
+	case *mapNode:
+		return reflect.TypeOf(map[string]interface{}(nil)), c.checkArgs(n.Values)
+	case *binaryNode:
+		return c.checkBinary(n)
+	case *unaryNode:
+		_, ok := c.checkArg(n.Operand)
+		if n.Op == "!" {
+			return reflect.TypeOf(false), ok
+		}
+		return nil, ok
+	case *callNode:
+		return c.checkExpression(n.Func, n.Args)
+	}
+
+	return nil, true
+}
+
+// checkArgs checks the elements of a list or map literal. It reports
+// whether all of them could be resolved.
+func (c *checker) checkArgs(nodes []Node) bool {
+	ok := true
+	for _, n := range nodes {
+		if _, nok := c.checkArg(n); !nok {
+			ok = false
+		}
+	}
+	return ok
+}
+
+// checkBinary returns the type of a binary operator. Comparisons and
+// logical operators are bool. The type of arithmetic is only known
+// when executing, as it depends on the values.
+func (c *checker) checkBinary(n *binaryNode) (reflect.Type, bool) {
+	a, aok := c.checkArg(n.Left)
+	b, bok := c.checkArg(n.Right)
+	if !aok || !bok {
+		return nil, false
+	}
+
+	switch n.Op {
+	case "??":
+		if a == b {
+			return a, true
+		}
+		return nil, true
+	case "+", "-", "*", "/", "%":
+		return nil, true
+	}
+
+	return reflect.TypeOf(false), true
+}
+
+// checkIdentifier resolves the path of an identifier like
+// state.evalIdentifier does and calls the result with nargs arguments.
+func (c *checker) checkIdentifier(id *identifierNode, nargs int) (reflect.Type, bool) {
+	var (
+		typ   reflect.Type
+		found bool
+		path  = id.path[1:]
+	)
+
+	if i, rest, ok := id.anchor(len(c.stack)); ok {
+		if i < 0 {
+			c.errorf(id, "%s: no context above the root", id.Name())
+			return nil, false
+		}
+		typ, found, path = c.stack[i], true, rest
+		if len(rest) > 0 {
+			if t, ok := c.params[i][rest[0]]; ok {
+				typ, path = t, rest[1:]
+			}
+		}
+	} else if strings.HasPrefix(id.path[0], "@") {
+		if !isVariable(id.path[0]) {
+			c.errorf(id, "unknown variable %s", id.path[0])
+			return nil, false
+		}
+		typ, found = variableType(id.path[0]), true
+	} else {
+		for i := len(c.locals) - 1; i >= 0 && !found; i-- {
+			if c.locals[i].name == id.path[0] {
+				typ, found = c.locals[i].typ, true
+			}
+		}
+	}
+
+	for i := len(c.stack) - 1; i >= 0 && !found; i-- {
+		if t, ok := c.params[i][id.path[0]]; ok {
+			typ, found = t, true
+			break
+		}
+		if c.stack[i] == nil {
+			return nil, true
+		}
+		typ, found = lookupType(c.stack[i], id.path[0])
+	}
+
+	if !found {
+		c.errorf(id, "%s: no field, method or key %q in %s", id.Name(), id.path[0], c.stackString())
+		return nil, false
+	}
+
+	for _, name := range path {
+		t, ok := callType(typ, 0)
+		if !ok {
+			c.errorf(id, "%s: %s needs arguments", id.Name(), typ)
+			return nil, false
+		}
+		if t == nil {
+			return nil, true
+		}
+		if typ, found = lookupType(t, name); !found {
+			c.errorf(id, "%s: no field, method or key %q in %s", id.Name(), name, t)
+			return nil, false
+		}
+	}
+
+	t, ok := callType(typ, nargs)
+	if !ok {
+		c.errorf(id, "cannot call %s with %d arguments", id.Name(), nargs)
+		return nil, false
+	}
+
+	return t, true
+}
+
+// variableType returns the type of a variable like @index. The
+// type of @key depends on the block helper that sets it.
+func variableType(name string) reflect.Type {
+	switch name {
+	case "@index", "@length":
+		return reflect.TypeOf(0)
+	case "@first", "@last":
+		return reflect.TypeOf(false)
+	}
+	return nil
+}
+
+func (c *checker) stackString() string {
+	s := ""
+	for i := len(c.stack) - 1; i >= 0; i-- {
+		if s != "" {
+			s += ", "
+		}
+		s += c.stack[i].String()
+	}
+	return s
+}
+
+// lookupType returns the type of the field, method or map value called
+// name of typ. A nil type means that the type is not known statically.
+func lookupType(typ reflect.Type, name string) (reflect.Type, bool) {
+	if typ == nil {
+		return nil, true
+	}
+	name = segmentKey(name)
+
+	if m, ok := typ.MethodByName(name); ok {
+		return methodType(typ, m), true
+	}
+
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	switch typ.Kind() {
+	case reflect.Interface:
+		return nil, true
+	case reflect.Struct:
+		if f, ok := typ.FieldByName(name); ok && f.IsExported() {
+			return f.Type, true
+		}
+		if m, ok := reflect.PointerTo(typ).MethodByName(name); ok {
+			return methodType(typ, m), true
+		}
+	case reflect.Map:
+		if typ.Key().Kind() == reflect.String {
+			return typ.Elem(), true
+		}
+	case reflect.Slice, reflect.Array:
+		if _, err := strconv.Atoi(name); err == nil {
+			return typ.Elem(), true
+		}
+	}
+
+	return nil, false
+}
+
+// methodType returns the function type of a method without its receiver.
+func methodType(typ reflect.Type, m reflect.Method) reflect.Type {
+	if typ.Kind() == reflect.Interface {
+		return m.Type
+	}
+
+	in := make([]reflect.Type, m.Type.NumIn()-1)
+	for i := range in {
+		in[i] = m.Type.In(i + 1)
+	}
+	out := make([]reflect.Type, m.Type.NumOut())
+	for i := range out {
+		out[i] = m.Type.Out(i)
+	}
+
+	return reflect.FuncOf(in, out, m.Type.IsVariadic())
+}
+
+// callType returns the type that call returns when typ is called with
+// nargs arguments. Types that aren't functions are returned as they are.
+func callType(typ reflect.Type, nargs int) (reflect.Type, bool) {
+	if typ == nil || typ.Kind() != reflect.Func {
+		return typ, true
+	}
+
+	if !typ.IsVariadic() && typ.NumIn() != nargs || typ.IsVariadic() && nargs < typ.NumIn()-1 {
+		return nil, false
+	}
+	if typ.NumOut() == 0 || typ.NumOut() > 2 || typ.NumOut() == 2 && typ.Out(1) != errorType {
+		return nil, false
+	}
+
+	return typ.Out(0), true
+}
+
+func indirectType(typ reflect.Type) reflect.Type {
+	for typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ
+}
+
+// Typed wraps a Template so that it can only be executed with data of
+// type T. Every template is checked with CheckTypes before its first
+// execution, and again when it or a template it includes has changed
+// in the storage.
+type Typed[T any] struct {
+	t       *Template
+	typ     reflect.Type
+	checked sync.Map // Template name to result of CheckTypes.
+}
+
+// NewTyped returns a Typed for t and checks the named templates
+// against T immediately.
+func NewTyped[T any](t *Template, names ...string) (*Typed[T], error) {
+	tt := &Typed[T]{t: t, typ: reflect.TypeOf((*T)(nil)).Elem()}
+
+	var errs []error
+	for _, name := range names {
+		errs = append(errs, tt.check(name))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	return tt, nil
+}
+
+func (t *Typed[T]) check(name string) error {
+	if r, ok := t.checked.Load(name); ok && r.(checkResult).current(t.t.nodes) {
+		return r.(checkResult).err
+	}
+
+	deps, err := t.t.checkTypes(name, t.typ)
+	t.checked.Store(name, checkResult{deps, err})
+
+	return err
+}
+
+// Execute checks the template name against T, if that hasn't been done
+// since it last changed, and executes it with data.
+func (t *Typed[T]) Execute(wr io.Writer, name string, data T) error {
+	if err := t.check(name); err != nil {
+		return err
+	}
+
+	return t.t.Execute(wr, name, data)
+}
+
+// checkResult holds the result of CheckTypes in Typed.checked, with
+// the nodes of the templates that were checked.
+type checkResult struct {
+	deps map[templateDep]Node
+	err  error
+}
+
+// current reports whether the storage still has the
+// same nodes as when the result was made.
+func (r checkResult) current(nodes NodeStorage) bool {
+	for dep, n := range r.deps {
+		if dep.lookup(nodes) != n {
+			return false
+		}
+	}
+	return true
+}
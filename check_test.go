@@ -0,0 +1,132 @@
+package template
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var checkTests = []struct {
+	name  string
+	input string
+	err   string
+}{
+	{"fields", "((Title))((User.Name))((Count))", ""},
+	{"missing-field", "((Titel))", `no field, method or key "Titel"`},
+	{"missing-path", "((User.Nmae))", `no field, method or key "Nmae" in *template.execUser`},
+	{"method", `((User.Greet "Hi"))((User.Initial))`, ""},
+	{"method-args", `((User.Greet))`, "cannot call User.Greet with 0 arguments"},
+	{"section-list", "((#Users))((Name))((Title))((/Users))", ""},
+	{"section-list-missing", "((#Users))((Title))((Nope))((/Users))", `"Nope" in template.execUser, *template.execData`},
+	{"section-map", "((#User.Meta))((@key))=((.))((/User.Meta))", ""},
+	{"section-bool", "((#User.Admin))((Title))((/User.Admin))", ""},
+	{"loop-variables", "((#Users))((@index))((#@first))((Name))((/@first))((/Users))", ""},
+	{"unknown-variable", "((#Users))((@nope))((/Users))", "unknown variable @nope"},
+	{"parent", "((#Users))((../Title))((@root.User.Name))((#..))((Count))((/..))((/Users))", ""},
+	{"parent-missing", "((#Users))((../Name))((/Users))", `../Name: no field, method or key "Name" in *template.execData`},
+	{"above-root", "((../Title))", "../Title: no context above the root"},
+	{"index", `((Users[-1].Name))((Users.0.Initial))((Headers["Content-Type"]))`, ""},
+	{"index-missing", "((Users.0.Nope))", `Users.0.Nope: no field, method or key "Nope" in template.execUser`},
+	{"index-not-list", "((Title[0]))", `Title[0]: no field, method or key "[0]" in string`},
+	{"dynamic-partial", "((#Widgets))((>*Template))((/Widgets))", ""},
+	{"dynamic-partial-missing", "((>*Nope))", `no field, method or key "Nope"`},
+	{"partial-args", `((>card_check User title="Sale"))((#Users))((>card_check title=Name))((/Users))`, ""},
+	{"partial-context-type", `((>card_check Title title="x"))`, `card_check:@11: Name: no field, method or key "Name" in string`},
+	{"partial-bad-param", `((>card_check User title=Nope))`, `no field, method or key "Nope"`},
+	{"partial-params-parent", "((#Users))((>up_check title=Name))((/Users))", ""},
+	{"operators", `((#Count > 0 && User.Admin))((Title))((/))((-User.Meta.age))((User.Greet "x" == Title))((Title ?? "none"))`, ""},
+	{"operator-missing", "((#Count > 0 || Nope))((/))", `no field, method or key "Nope"`},
+	{"literals", `((User.OneOf [Title, true, nil]))((>card_check {Name: 1} title=[Count]))`, ""},
+	{"literal-missing", `((User.OneOf [Title, Nope]))`, `no field, method or key "Nope"`},
+	{"else", "((#User))((Name))((else))((Title))((/User))", ""},
+	{"else-context", "((#User))((else))((Name))((/User))", `no field, method or key "Name" in *template.execData`},
+	{"let", "((let u = User))((u.Name))((#Users))((let n = Name))((n))((/Users))((let m = Nope))((m.x))", `no field, method or key "Nope"`},
+	{"let-scope", "((#User))((let t = Name))((/User))((t))", `t: no field, method or key "t"`},
+	{"let-field", "((let u = User))((u.Nope))", `u.Nope: no field, method or key "Nope"`},
+	{"partial", "((#User))((>user))((/User))", ""},
+	{"partial-missing-field", "((>bad))", `bad:@2: Nope`},
+	{"inherit", "((<layout))(($body))((Nope))((/body))((/layout))", `inherit:@22: Nope`},
+	{"recursive", "((#Users))((>recursive))((/Users))", ""},
+}
+
+func TestCheckTypes(t *testing.T) {
+	for _, test := range checkTests {
+		sources := map[string]string{
+			test.name:    test.input,
+			"user":       "((Name))",
+			"bad":        "((Nope))",
+			"layout":     "(($title))((Title))((/title))(($body))((/body))",
+			"card_check": "((title))((Name))",
+			"up_check":   "((../Title))((title))",
+		}
+
+		err := parseTemplates(t, sources).CheckTypes(test.name, reflect.TypeOf(execTestData))
+
+		switch {
+		case err != nil && test.err == "":
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		case err != nil && !strings.Contains(err.Error(), test.err):
+			t.Errorf("%s: got error\n\t%v\nexpected\n\t%v", test.name, err, test.err)
+		case err == nil && test.err != "":
+			t.Errorf("%s: expected error; got none", test.name)
+		}
+	}
+}
+
+func TestTyped(t *testing.T) {
+	tmpl := parseTemplates(t, map[string]string{
+		"good": "((User.Name))",
+		"bad":  "((User.Nmae))",
+	})
+
+	if _, err := NewTyped[*execData](tmpl, "good", "bad"); err == nil {
+		t.Error("expected error; got none")
+	}
+
+	typed, err := NewTyped[*execData](tmpl, "good")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := typed.Execute(&buf, "good", execTestData); err != nil {
+		t.Fatal(err)
+	} else if buf.String() != "Ann" {
+		t.Errorf("got %q", buf.String())
+	}
+
+	if err := typed.Execute(&buf, "bad", execTestData); err == nil {
+		t.Error("expected error; got none")
+	}
+}
+
+func TestTypedChanged(t *testing.T) {
+	nodes := NewNodeMap(map[string]Node{
+		"page": parseOptions(t, "page", MustacheOptions(), "{{>part}}{{>extra}}"),
+		"part": parseOptions(t, "part", nil, "((User.Name))"),
+	})
+	typed, err := NewTyped[*execData](New(nodes), "page")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name, src string
+		ok        bool
+	}{
+		{"part", "((User.Nmae))", false},
+		{"part", "((User.Name))", true},
+		{"extra", "((Nope))", false},
+		{"extra", "((Count))", true},
+	}
+
+	for _, step := range steps {
+		nodes.Set(step.name, parseOptions(t, step.name, nil, step.src))
+
+		var buf bytes.Buffer
+		if err := typed.Execute(&buf, "page", execTestData); (err == nil) != step.ok {
+			t.Errorf("%s %q: unexpected error: %v", step.name, step.src, err)
+		}
+	}
+}
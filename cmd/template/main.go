@@ -0,0 +1,240 @@
+// Command template renders templates from the command line.
+//
+// Usage:
+//
+//	template render [flags] name
+//
+// The render command loads every file in a directory with a matching
+// extension, as ParseFiles does, and renders the template name with data
+// read from a JSON or YAML file. Only a basic subset of YAML is supported:
+// block mappings and sequences, plain and quoted scalars, literal (|) and
+// folded (>) block scalars, and flow sequences and mappings on one line.
+//
+// The flags are:
+//
+//	-dir	directory with templates (default ".")
+//	-data	file with data; "-" reads the standard input
+//	-format	format of the data, "json" or "yaml"; by default it's
+//		detected from the extension of the file or its content
+//	-o	write the output to this file instead of stdout; the file
+//		isn't touched if rendering fails
+//	-left, -right
+//		delimiters, like Options.LeftDelim and Options.RightDelim
+//	-strip	strip file extensions from template names, like
+//		Options.StripExtension
+//	-ext	comma-separated list of extensions of template files
+//	-mustache
+//		parse standard Mustache, like MustacheOptions; -left
+//		and -right are ignored
+//	-kebab	allow hyphens in identifiers, like Options.KebabCase
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/FSX/template"
+	"github.com/FSX/template/internal/tmplfile"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: template render [flags] name\n")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "render":
+		if err := render(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	default:
+		usage()
+	}
+}
+
+func render(args []string) error {
+	flags := flag.NewFlagSet("render", flag.ExitOnError)
+	dir := flags.String("dir", ".", "directory with templates")
+	dataFile := flags.String("data", "", `file with data; "-" reads the standard input`)
+	format := flags.String("format", "", `format of the data, "json" or "yaml"; detected by default`)
+	output := flags.String("o", "", "write the output to this file instead of stdout")
+	leftDelim := flags.String("left", "", "left delimiter")
+	rightDelim := flags.String("right", "", "right delimiter")
+	stripExt := flags.Bool("strip", false, "strip file extensions from template names")
+	extensions := flags.String("ext", ".tmpl,.html,.mustache", "extensions of template files")
+	mustache := flags.Bool("mustache", false, "parse standard Mustache templates")
+	kebab := flags.Bool("kebab", false, "allow hyphens in identifiers, like created-at")
+
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: template render [flags] name\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	filenames, err := templateFiles(*dir, strings.Split(*extensions, ","))
+	if err != nil {
+		return err
+	}
+
+	options := &template.Options{
+		LeftDelim:      *leftDelim,
+		RightDelim:     *rightDelim,
+		StripExtension: *stripExt,
+	}
+	if *mustache {
+		options = template.MustacheOptions()
+		options.StripExtension = *stripExt
+	}
+	options.KebabCase = *kebab
+
+	t, err := template.ParseFiles(options, *dir, filenames...)
+	if err != nil {
+		return err
+	}
+
+	data, err := readData(*dataFile, *format)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, flags.Arg(0), data); err != nil {
+		return err
+	}
+
+	if *output == "" {
+		_, err = os.Stdout.Write(buf.Bytes())
+		return err
+	}
+
+	return ioutil.WriteFile(*output, buf.Bytes(), 0644)
+}
+
+// templateFiles returns the paths, relative to dir, of all files
+// in dir that have one of the extensions. Hidden files and
+// directories are skipped.
+func templateFiles(dir string, extensions []string) ([]string, error) {
+	filenames, err := tmplfile.Find(dir, extensions)
+	if err == nil && len(filenames) == 0 {
+		err = fmt.Errorf("no templates found in %s", dir)
+	}
+
+	return filenames, err
+}
+
+// readData reads and decodes the data in fn. Without a file there's no data.
+func readData(fn, format string) (interface{}, error) {
+	var (
+		b   []byte
+		err error
+	)
+
+	switch fn {
+	case "":
+		return nil, nil
+	case "-":
+		b, err = ioutil.ReadAll(os.Stdin)
+	default:
+		b, err = ioutil.ReadFile(fn)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if format == "" {
+		format = detectFormat(fn, b)
+	}
+
+	var data interface{}
+
+	switch format {
+	case "json":
+		data, err = decodeJSON(b)
+	case "yaml":
+		data, err = decodeYAML(b)
+	default:
+		return nil, fmt.Errorf("unknown data format %q", format)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", fn, err)
+	}
+
+	return data, nil
+}
+
+// decodeJSON decodes JSON like encoding/json, except that integers are
+// decoded as int64, like decodeYAML does, so that 10000000 is rendered
+// as it's written and not as 1e+07.
+func decodeJSON(b []byte) (interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+
+	var data interface{}
+	if err := d.Decode(&data); err != nil {
+		return nil, err
+	}
+	if _, err := d.Token(); err != io.EOF {
+		return nil, errors.New("invalid data after top-level value")
+	}
+
+	return convertNumbers(data), nil
+}
+
+// convertNumbers replaces the json.Numbers in v by int64 or float64.
+func convertNumbers(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case []interface{}:
+		for i, e := range v {
+			v[i] = convertNumbers(e)
+		}
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = convertNumbers(e)
+		}
+	}
+
+	return v
+}
+
+// detectFormat detects the format of the data in file fn by
+// its extension, or by its content if that doesn't tell.
+func detectFormat(fn string, b []byte) string {
+	switch strings.ToLower(filepath.Ext(fn)) {
+	case ".json":
+		return "json"
+	case ".yaml", ".yml":
+		return "yaml"
+	}
+
+	if b := bytes.TrimSpace(b); len(b) > 0 && (b[0] == '{' || b[0] == '[') && json.Valid(b) {
+		return "json"
+	}
+
+	return "yaml"
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		fn, data, format string
+	}{
+		{"data.json", "a: 1", "json"},
+		{"data.JSON", "", "json"},
+		{"data.yaml", `{"a": 1}`, "yaml"},
+		{"data.yml", "", "yaml"},
+		{"-", ` {"a": 1} `, "json"},
+		{"-", `[1, 2]`, "json"},
+		{"data", "[a, b]", "yaml"},
+		{"data.txt", "{a: 1}", "yaml"},
+		{"-", "a: 1", "yaml"},
+		{"-", "", "yaml"},
+	}
+
+	for _, test := range tests {
+		if format := detectFormat(test.fn, []byte(test.data)); format != test.format {
+			t.Errorf("%s %q: got %s, expected %s", test.fn, test.data, format, test.format)
+		}
+	}
+}
+
+// writeFiles writes files, relative to a new temporary directory,
+// and returns the directory.
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "template")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	for name, content := range files {
+		fn := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fn, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestTemplateFiles(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"index.tmpl":         "",
+		"users/list.html":    "",
+		"users/.hidden.tmpl": "",
+		".git/config.tmpl":   "",
+		"data.json":          "",
+		"notes.tmpl.bak":     "",
+	})
+
+	filenames, err := templateFiles(dir, []string{".tmpl", ".html", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"index.tmpl", filepath.Join("users", "list.html")}
+	if !reflect.DeepEqual(filenames, expected) {
+		t.Errorf("got %q, expected %q", filenames, expected)
+	}
+
+	if _, err := templateFiles(dir, []string{".mustache"}); err == nil || err.Error() != "no templates found in "+dir {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		input string
+		value interface{}
+	}{
+		{"10000000", int64(10000000)},
+		{"-3", int64(-3)},
+		{"1.5", 1.5},
+		{"1e3", 1000.0},
+		{"99999999999999999999", 1e20},
+		{`{"a": [1, {"b": 2.5}], "c": "d"}`, map[string]interface{}{"a": []interface{}{int64(1), map[string]interface{}{"b": 2.5}}, "c": "d"}},
+	}
+
+	for _, test := range tests {
+		v, err := decodeJSON([]byte(test.input))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.input, err)
+		} else if !reflect.DeepEqual(v, test.value) {
+			t.Errorf("%s: got %#v, expected %#v", test.input, v, test.value)
+		}
+	}
+
+	for _, input := range []string{"{", "1 2", "[1] x"} {
+		if _, err := decodeJSON([]byte(input)); err == nil {
+			t.Errorf("%s: expected an error", input)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"pages/index.tmpl":    "((< ../layout))(($body))((#users))((> ./user))((/users))((/body))((/ ../layout))",
+		"pages/user.tmpl":     "[((name))]",
+		"layout.tmpl":         "((title)): (($body))((/body))\n",
+		"data/page.yaml":      "title: Users\nusers:\n  - name: Ann\n  - name: Bob\n",
+		"data/broken.json":    "{",
+		"data/count.json":     `{"title": 10000000, "users": [{"name": 1.5}]}`,
+		"output/keep.txt":     "kept",
+		"pages/ignored.notes": "((",
+	})
+
+	out := filepath.Join(dir, "output", "page.txt")
+	args := []string{"-dir", dir, "-strip", "-data", filepath.Join(dir, "data", "page.yaml"), "-o", out, "pages/index"}
+	if err := render(args); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(out); err != nil {
+		t.Fatal(err)
+	} else if string(b) != "Users: [Ann][Bob]\n" {
+		t.Errorf("got %q", b)
+	}
+
+	args = []string{"-dir", dir, "-strip", "-data", filepath.Join(dir, "data", "count.json"), "-o", out, "pages/index"}
+	if err := render(args); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(out); err != nil {
+		t.Fatal(err)
+	} else if string(b) != "10000000: [1.5]\n" {
+		t.Errorf("got %q", b)
+	}
+
+	keep := filepath.Join(dir, "output", "keep.txt")
+	args = []string{"-dir", dir, "-strip", "-data", filepath.Join(dir, "data", "broken.json"), "-o", keep, "pages/index"}
+	if err := render(args); err == nil {
+		t.Error("expected an error for invalid data")
+	}
+	if b, err := ioutil.ReadFile(keep); err != nil || string(b) != "kept" {
+		t.Errorf("output was changed after an error: %q, %v", b, err)
+	}
+}
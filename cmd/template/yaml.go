@@ -0,0 +1,450 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// yamlLine is a line of a YAML document without its
+// indentation and comment.
+type yamlLine struct {
+	num    int // Line number, starting at 1.
+	indent int
+	text   string
+}
+
+type yamlDecoder struct {
+	lines []yamlLine
+	pos   int
+	raw   []string // All lines, for block scalars.
+}
+
+// decodeYAML decodes a basic subset of YAML to the same kind of values as
+// encoding/json, except that integers are decoded as int64. Anchors, tags,
+// multi-line flow collections and multiple documents are not supported.
+func decodeYAML(b []byte) (interface{}, error) {
+	d := &yamlDecoder{raw: strings.Split(strings.ReplaceAll(string(b), "\r\n", "\n"), "\n")}
+
+	for i, raw := range d.raw {
+		if i == 0 && strings.TrimSpace(raw) == "---" {
+			continue
+		}
+
+		text := strings.TrimRight(stripComment(raw), " \t")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("yaml: line %d: tabs are not allowed in indentation", i+1)
+		}
+
+		d.lines = append(d.lines, yamlLine{i + 1, len(text) - len(trimmed), trimmed})
+	}
+
+	if len(d.lines) == 0 {
+		return nil, nil
+	}
+
+	v, err := d.block(d.lines[0].indent)
+	if err == nil && d.pos < len(d.lines) {
+		err = d.errorf("unexpected indentation")
+	}
+
+	return v, err
+}
+
+// stripComment removes a comment that starts with " #" or at
+// the start of the line, outside of quotes.
+func stripComment(s string) string {
+	var quote byte
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return s[:i]
+		}
+	}
+
+	return s
+}
+
+func (d *yamlDecoder) errorf(format string, args ...interface{}) error {
+	num := len(d.raw)
+	if d.pos < len(d.lines) {
+		num = d.lines[d.pos].num
+	}
+	return fmt.Errorf("yaml: line %d: %s", num, fmt.Sprintf(format, args...))
+}
+
+// block decodes the node that starts at the current line,
+// which is indented by indent.
+func (d *yamlDecoder) block(indent int) (interface{}, error) {
+	l := d.lines[d.pos]
+
+	switch {
+	case l.text == "-" || strings.HasPrefix(l.text, "- "):
+		return d.sequence(indent)
+	case mappingKey(l.text) >= 0:
+		return d.mapping(indent)
+	}
+
+	d.pos++
+	return scalar(l.text)
+}
+
+func (d *yamlDecoder) sequence(indent int) (interface{}, error) {
+	s := []interface{}{}
+
+	for d.pos < len(d.lines) {
+		l := d.lines[d.pos]
+		if l.indent < indent {
+			break
+		}
+		if l.indent > indent {
+			return nil, d.errorf("unexpected indentation")
+		}
+		if l.text != "-" && !strings.HasPrefix(l.text, "- ") {
+			break
+		}
+
+		v, err := d.item(l, indent, strings.TrimLeft(l.text[1:], " "))
+		if err != nil {
+			return nil, err
+		}
+
+		s = append(s, v)
+	}
+
+	return s, nil
+}
+
+// item decodes the value of a sequence item or mapping key on line l,
+// which is indented by indent. rest is the text after the "-" or ":".
+func (d *yamlDecoder) item(l yamlLine, indent int, rest string) (interface{}, error) {
+	switch {
+	case rest == "":
+		d.pos++
+		if d.pos < len(d.lines) && d.lines[d.pos].indent > indent {
+			return d.block(d.lines[d.pos].indent)
+		}
+		return nil, nil
+	case rest == "|" || rest == ">" || rest == "|-" || rest == ">-":
+		d.pos++
+		return d.blockScalar(l, indent, rest), nil
+	case l.text[0] == '-' && (rest == "-" || strings.HasPrefix(rest, "- ") || mappingKey(rest) >= 0):
+		// A nested node on the same line as "- ": continue
+		// as if it started on its own line.
+		d.lines[d.pos] = yamlLine{l.num, l.indent + len(l.text) - len(rest), rest}
+		return d.block(d.lines[d.pos].indent)
+	}
+
+	d.pos++
+	v, err := scalar(rest)
+	if err != nil {
+		return nil, fmt.Errorf("yaml: line %d: %v", l.num, err)
+	}
+	return v, nil
+}
+
+func (d *yamlDecoder) mapping(indent int) (interface{}, error) {
+	m := make(map[string]interface{})
+
+	for d.pos < len(d.lines) {
+		l := d.lines[d.pos]
+		if l.indent < indent {
+			break
+		}
+		if l.indent > indent {
+			return nil, d.errorf("unexpected indentation")
+		}
+
+		i := mappingKey(l.text)
+		if i < 0 {
+			return nil, d.errorf("expected a key")
+		}
+
+		key, err := scalar(l.text[:i])
+		if err != nil {
+			return nil, d.errorf("%v", err)
+		}
+		rest := strings.TrimLeft(l.text[i+1:], " ")
+
+		var v interface{}
+		if rest == "" && d.pos+1 < len(d.lines) && d.lines[d.pos+1].indent == indent && strings.HasPrefix(d.lines[d.pos+1].text, "-") {
+			// A sequence that isn't indented under its key.
+			d.pos++
+			v, err = d.sequence(indent)
+		} else {
+			v, err = d.item(l, indent, rest)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		m[fmt.Sprint(key)] = v
+	}
+
+	return m, nil
+}
+
+// blockScalar reads the lines of a literal (|) or folded (>) block
+// scalar after line l. The lines must be indented more than indent.
+func (d *yamlDecoder) blockScalar(l yamlLine, indent int, style string) string {
+	var lines []string
+	end := l.num
+
+	for i := l.num; i < len(d.raw); i++ {
+		raw := d.raw[i]
+		trimmed := strings.TrimLeft(raw, " ")
+		if trimmed != "" && len(raw)-len(trimmed) <= indent {
+			break
+		}
+		lines = append(lines, raw)
+		end = i + 1
+	}
+
+	// Skip the lines that were read, including those that
+	// only looked like content.
+	for d.pos < len(d.lines) && d.lines[d.pos].num <= end {
+		d.pos++
+	}
+
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	strip := -1
+	for _, line := range lines {
+		if trimmed := strings.TrimLeft(line, " "); trimmed != "" {
+			if n := len(line) - len(trimmed); strip < 0 || n < strip {
+				strip = n
+			}
+		}
+	}
+	for i, line := range lines {
+		if len(line) >= strip && strip > 0 {
+			lines[i] = line[strip:]
+		} else {
+			lines[i] = strings.TrimLeft(line, " ")
+		}
+	}
+
+	var s string
+	if style[0] == '|' {
+		s = strings.Join(lines, "\n")
+	} else {
+		s = foldLines(lines)
+	}
+
+	if len(lines) > 0 && !strings.HasSuffix(style, "-") {
+		s += "\n"
+	}
+
+	return s
+}
+
+// foldLines joins lines with spaces. Empty lines become newlines.
+func foldLines(lines []string) string {
+	var b strings.Builder
+
+	for i, line := range lines {
+		switch {
+		case line == "":
+			b.WriteByte('\n')
+		case i > 0 && lines[i-1] != "":
+			b.WriteByte(' ')
+			fallthrough
+		default:
+			b.WriteString(line)
+		}
+	}
+
+	return b.String()
+}
+
+// mappingKey returns the index of the colon after the key of a mapping
+// entry in s, or -1 if s isn't a mapping entry.
+func mappingKey(s string) int {
+	if s == "" || s[0] == '[' || s[0] == '{' {
+		return -1
+	}
+
+	if s[0] == '"' || s[0] == '\'' {
+		end := quoteEnd(s)
+		if end < 0 || end+1 >= len(s) || s[end+1] != ':' {
+			return -1
+		}
+		if end+2 < len(s) && s[end+2] != ' ' {
+			return -1
+		}
+		return end + 1
+	}
+
+	for i := 0; i < len(s); i++ {
+		if s[i] == ':' && (i+1 == len(s) || s[i+1] == ' ') {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// quoteEnd returns the index of the quote that ends the quoted
+// string at the start of s, or -1 if it isn't terminated.
+func quoteEnd(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[0] == '"' && s[i] == '\\':
+			i++
+		case s[i] == s[0]:
+			if s[0] == '\'' && i+1 < len(s) && s[i+1] == '\'' {
+				i++
+				continue
+			}
+			return i
+		}
+	}
+	return -1
+}
+
+// scalar decodes a value on a single line: a quoted or plain
+// scalar, or a flow sequence or mapping.
+func scalar(s string) (interface{}, error) {
+	s = strings.TrimSpace(s)
+
+	switch {
+	case s == "":
+		return nil, nil
+	case s[0] == '"':
+		if quoteEnd(s) != len(s)-1 {
+			return nil, fmt.Errorf("invalid quoted string %s", s)
+		}
+		return strconv.Unquote(s)
+	case s[0] == '\'':
+		if quoteEnd(s) != len(s)-1 {
+			return nil, fmt.Errorf("invalid quoted string %s", s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	case s[0] == '[' || s[0] == '{':
+		return flow(s)
+	}
+
+	switch s {
+	case "~", "null", "Null", "NULL":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, nil
+	}
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0o") {
+		if i, err := strconv.ParseInt(s, 0, 64); err == nil {
+			return i, nil
+		}
+	}
+	if strings.ContainsAny(s, "0123456789") && !strings.ContainsAny(s, "xX_") {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f, nil
+		}
+	}
+
+	return s, nil
+}
+
+// flow decodes a flow sequence or mapping, like [a, b] or {a: 1}.
+func flow(s string) (interface{}, error) {
+	closing := "]"
+	if s[0] == '{' {
+		closing = "}"
+	}
+	if !strings.HasSuffix(s, closing) {
+		return nil, fmt.Errorf("unterminated flow collection %s", s)
+	}
+
+	items, err := splitFlow(s[1 : len(s)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	if s[0] == '[' {
+		seq := []interface{}{}
+		for _, item := range items {
+			v, err := scalar(item)
+			if err != nil {
+				return nil, err
+			}
+			seq = append(seq, v)
+		}
+		return seq, nil
+	}
+
+	m := make(map[string]interface{})
+	for _, item := range items {
+		i := mappingKey(item)
+		if i < 0 {
+			return nil, fmt.Errorf("expected a key in %s", item)
+		}
+		key, err := scalar(item[:i])
+		if err != nil {
+			return nil, err
+		}
+		v, err := scalar(item[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		m[fmt.Sprint(key)] = v
+	}
+	return m, nil
+}
+
+// splitFlow splits the items of a flow collection at the commas
+// that are not in quotes or nested collections.
+func splitFlow(s string) ([]string, error) {
+	var (
+		items []string
+		depth int
+		start int
+	)
+
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"', '\'':
+			end := quoteEnd(s[i:])
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string in %s", s)
+			}
+			i += end
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				items = append(items, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	if last := strings.TrimSpace(s[start:]); last != "" || len(items) > 0 {
+		items = append(items, s[start:])
+	}
+
+	return items, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+type obj = map[string]interface{}
+type list = []interface{}
+
+var yamlTests = []struct {
+	name  string
+	input string
+	value interface{}
+}{
+	{"empty", "", nil},
+	{"document-start", "---\na: 1\n", obj{"a": int64(1)}},
+	{"plain", "a: text with spaces\nb: 1.5\nc: -3\nd: 0x1f\ne: true\nf: null\ng: ~\nh:\n", obj{"a": "text with spaces", "b": 1.5, "c": int64(-3), "d": int64(31), "e": true, "f": nil, "g": nil, "h": nil}},
+	{"scalar", "hello", "hello"},
+	{"mapping", "a:\n  b: 1\n  c:\n    d: x\ne: 2\n", obj{"a": obj{"b": int64(1), "c": obj{"d": "x"}}, "e": int64(2)}},
+	{"sequence", "- a\n- 1\n-\n  - b\n  - c\n", list{"a", int64(1), list{"b", "c"}}},
+	{"sequence-of-mappings", "- name: a\n  age: 1\n- name: b\n", list{obj{"name": "a", "age": int64(1)}, obj{"name": "b"}}},
+	{"unindented-sequence", "items:\n- a\n- b\nnext: 1\n", obj{"items": list{"a", "b"}, "next": int64(1)}},
+	{"nested-sequence", "- - a\n  - b\n- c\n", list{list{"a", "b"}, "c"}},
+	{"double-quoted", `a: "x: \"y\" # z\n"`, obj{"a": "x: \"y\" # z\n"}},
+	{"single-quoted", `a: 'it''s # here'`, obj{"a": "it's # here"}},
+	{"quoted-key", "\"a b\": 1\n'c:d': 2\n", obj{"a b": int64(1), "c:d": int64(2)}},
+	{"quoted-number", `a: "1"`, obj{"a": "1"}},
+	{"comments", "# comment\na: 1 # comment\nb: x#y\n  # indented comment\nc: 2\n", obj{"a": int64(1), "b": "x#y", "c": int64(2)}},
+	{"literal", "a: |\n  line 1\n\n    line 2\nb: 1\n", obj{"a": "line 1\n\n  line 2\n", "b": int64(1)}},
+	{"literal-strip", "a: |-\n  x\n  y\n\n", obj{"a": "x\ny"}},
+	{"literal-comment", "a: |\n  # not a comment\n", obj{"a": "# not a comment\n"}},
+	{"folded", "a: >\n  one\n  two\n\n  three\n", obj{"a": "one two\nthree\n"}},
+	{"folded-strip", "- >-\n  one\n  two\n", list{"one two"}},
+	{"flow-sequence", "a: [1, b, \"c, d\", [e]]\nb: []\n", obj{"a": list{int64(1), "b", "c, d", list{"e"}}, "b": list{}}},
+	{"flow-mapping", "a: {b: 1, \"c\": [x, y], d: {e: f}}\nb: {}\n", obj{"a": obj{"b": int64(1), "c": list{"x", "y"}, "d": obj{"e": "f"}}, "b": obj{}}},
+	{"crlf", "a: 1\r\nb: 2\r\n", obj{"a": int64(1), "b": int64(2)}},
+}
+
+func TestDecodeYAML(t *testing.T) {
+	for _, test := range yamlTests {
+		v, err := decodeYAML([]byte(test.input))
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		} else if !reflect.DeepEqual(v, test.value) {
+			t.Errorf("%s: got\n\t%#v\nexpected\n\t%#v", test.name, v, test.value)
+		}
+	}
+}
+
+var yamlErrorTests = []struct {
+	name  string
+	input string
+	err   string
+}{
+	{"tab", "a:\n\tb: 1\n", "yaml: line 2: tabs are not allowed in indentation"},
+	{"indentation", "a: 1\n  b: 2\n", "yaml: line 2: unexpected indentation"},
+	{"sequence-indentation", "- a\n   - b\n", "yaml: line 2: unexpected indentation"},
+	{"expected-key", "a:\n  b: 1\n  c\n", "yaml: line 3: expected a key"},
+	{"unterminated-quote", `a: "x`, "yaml: line 1: invalid quoted string \"x"},
+	{"unterminated-flow", "- [a, b\n", "yaml: line 1: unterminated flow collection [a, b"},
+	{"flow-key", "a: {b}\n", "yaml: line 1: expected a key in b"},
+	{"flow-string", "a: [\"b]\n", "yaml: line 1: unterminated string in \"b"},
+	{"trailing", "a\nb: 1\n", "yaml: line 2: unexpected indentation"},
+}
+
+func TestDecodeYAMLErrors(t *testing.T) {
+	for _, test := range yamlErrorTests {
+		_, err := decodeYAML([]byte(test.input))
+		if err == nil || err.Error() != test.err {
+			t.Errorf("%s: got error %v, expected %s", test.name, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// contextLines is the number of unchanged lines shown around a change.
+const contextLines = 3
+
+// op is a single line of an edit script.
+type op struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// diff returns a unified diff of old and new.
+func diff(name string, old, new []byte) []byte {
+	ops := editScript(splitLines(old), splitLines(new))
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s.orig\n+++ %s\n", name, name)
+
+	for i := 0; i < len(ops); {
+		// Find the next change.
+		for i < len(ops) && ops[i].kind == ' ' {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+
+		// Extend the hunk until a run of unchanged lines is long
+		// enough to separate it from the next change.
+		start := max(i-contextLines, 0)
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind != ' ' {
+				end = j + 1
+			} else if j-end >= 2*contextLines {
+				break
+			}
+		}
+		end = min(end+contextLines, len(ops))
+
+		writeHunk(&buf, ops, start, end)
+		i = end
+	}
+
+	return buf.Bytes()
+}
+
+func writeHunk(buf *bytes.Buffer, ops []op, start, end int) {
+	oldStart, newStart := 1, 1
+	for _, o := range ops[:start] {
+		if o.kind != '+' {
+			oldStart++
+		}
+		if o.kind != '-' {
+			newStart++
+		}
+	}
+
+	oldLen, newLen := 0, 0
+	for _, o := range ops[start:end] {
+		if o.kind != '+' {
+			oldLen++
+		}
+		if o.kind != '-' {
+			newLen++
+		}
+	}
+
+	fmt.Fprintf(buf, "@@ -%d,%d +%d,%d @@\n", oldStart, oldLen, newStart, newLen)
+	for _, o := range ops[start:end] {
+		buf.WriteByte(o.kind)
+		buf.WriteString(o.line)
+		if !strings.HasSuffix(o.line, "\n") {
+			buf.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// maxTable is the largest LCS table that editScript builds. Beyond it
+// the changed lines are shown as removed and added as a whole.
+const maxTable = 1 << 22
+
+// editScript computes the longest common subsequence of a and b and
+// returns the lines needed to turn a into b. The lines that a and b
+// start and end with are left out of the computation, so that the
+// table only covers the part that changed.
+func editScript(a, b []string) []op {
+	var prefix, suffix []op
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		prefix = append(prefix, op{' ', a[0]})
+		a, b = a[1:], b[1:]
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		suffix = append(suffix, op{' ', a[len(a)-1]})
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+	for i, j := 0, len(suffix)-1; i < j; i, j = i+1, j-1 {
+		suffix[i], suffix[j] = suffix[j], suffix[i]
+	}
+
+	ops := append(prefix, lcsScript(a, b)...)
+	return append(ops, suffix...)
+}
+
+// lcsScript returns the lines needed to turn a into b, computed with
+// a table of the longest common subsequences of their suffixes.
+func lcsScript(a, b []string) []op {
+	if (len(a)+1)*(len(b)+1) > maxTable {
+		ops := make([]op, 0, len(a)+len(b))
+		for _, line := range a {
+			ops = append(ops, op{'-', line})
+		}
+		for _, line := range b {
+			ops = append(ops, op{'+', line})
+		}
+		return ops
+	}
+
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []op
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, op{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, op{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, op{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, op{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, op{'+', b[j]})
+	}
+
+	return ops
+}
+
+// splitLines splits b after each newline.
+func splitLines(b []byte) []string {
+	lines := strings.SplitAfter(string(b), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
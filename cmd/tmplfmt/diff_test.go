@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		diff     string
+	}{
+		{"same", "a\nb\n", "a\nb\n", ""},
+		{"change", "1\n2\n3\n4\nx\n5\n6\n7\n8\n", "1\n2\n3\n4\ny\n5\n6\n7\n8\n",
+			"@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-x\n+y\n 5\n 6\n 7\n"},
+		{"two-hunks", "x\n1\n2\n3\n4\n5\n6\n7\nx\n", "y\n1\n2\n3\n4\n5\n6\n7\ny\n",
+			"@@ -1,4 +1,4 @@\n-x\n+y\n 1\n 2\n 3\n@@ -6,4 +6,4 @@\n 5\n 6\n 7\n-x\n+y\n"},
+		{"no-newline", "a\nb", "a\nc\n",
+			"@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n"},
+	}
+
+	for _, test := range tests {
+		d := string(diff("f", []byte(test.old), []byte(test.new)))
+		d = strings.TrimPrefix(d, "--- f.orig\n+++ f\n")
+		if d != test.diff {
+			t.Errorf("%s: got\n%s\nexpected\n%s", test.name, d, test.diff)
+		}
+	}
+}
+
+func TestEditScriptLarge(t *testing.T) {
+	const n = 5000
+
+	a := make([]string, n)
+	b := make([]string, n)
+	for i := range a {
+		a[i] = "a" + strings.Repeat("x", i%7) + "\n"
+		b[i] = "b" + strings.Repeat("x", i%7) + "\n"
+	}
+	// The same first and last lines are not part of the table.
+	a[0], b[0] = "same\n", "same\n"
+	a[n-1], b[n-1] = "same\n", "same\n"
+
+	ops := editScript(a, b)
+
+	removed, added := 0, 0
+	for _, o := range ops {
+		switch o.kind {
+		case '-':
+			removed++
+		case '+':
+			added++
+		}
+	}
+	if removed != n-2 || added != n-2 || len(ops) != 2*n-2 {
+		t.Errorf("got %d removed and %d added lines in %d, expected %d each", removed, added, len(ops), n-2)
+	}
+}
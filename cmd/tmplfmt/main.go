@@ -0,0 +1,161 @@
+// Command tmplfmt formats templates.
+//
+// Without an explicit path it processes the standard input. Given a file,
+// it operates on that file; given a directory, it operates on all files
+// with a matching extension in that directory, recursively.
+//
+// Usage:
+//
+//	tmplfmt [flags] [path ...]
+//
+// The flags are:
+//
+//	-d	display diffs instead of rewriting files
+//	-l	list files whose formatting differs from tmplfmt's
+//	-w	write result to (source) file instead of stdout
+//	-left, -right
+//		delimiters used by the templates
+//	-mustache
+//		format standard Mustache, like MustacheOptions; -left
+//		and -right are ignored
+//	-kebab	allow hyphens in identifiers, like Options.KebabCase
+//	-ext	comma-separated list of extensions to format in directories
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/FSX/template"
+	"github.com/FSX/template/internal/tmplfile"
+)
+
+var (
+	list       = flag.Bool("l", false, "list files whose formatting differs from tmplfmt's")
+	write      = flag.Bool("w", false, "write result to (source) file instead of stdout")
+	doDiff     = flag.Bool("d", false, "display diffs instead of rewriting files")
+	leftDelim  = flag.String("left", "", "left delimiter")
+	rightDelim = flag.String("right", "", "right delimiter")
+	mustache   = flag.Bool("mustache", false, "format standard Mustache templates")
+	kebab      = flag.Bool("kebab", false, "allow hyphens in identifiers, like created-at")
+	extensions = flag.String("ext", ".tmpl,.html,.mustache", "extensions to format in directories")
+)
+
+var exitCode = 0
+
+func report(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	exitCode = 2
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: tmplfmt [flags] [path ...]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		if *write {
+			report(fmt.Errorf("error: cannot use -w with standard input"))
+		} else if err := processFile("<standard input>", os.Stdin, os.Stdout); err != nil {
+			report(err)
+		}
+		os.Exit(exitCode)
+	}
+
+	for _, path := range flag.Args() {
+		switch info, err := os.Stat(path); {
+		case err != nil:
+			report(err)
+		case info.IsDir():
+			walkDir(path)
+		default:
+			if err := processFile(path, nil, os.Stdout); err != nil {
+				report(err)
+			}
+		}
+	}
+
+	os.Exit(exitCode)
+}
+
+func walkDir(dir string) {
+	filenames, err := tmplfile.Find(dir, strings.Split(*extensions, ","))
+	if err != nil {
+		report(err)
+	}
+
+	for _, fn := range filenames {
+		if err := processFile(filepath.Join(dir, fn), nil, os.Stdout); err != nil {
+			report(err)
+		}
+	}
+}
+
+// options returns the Options given by the flags.
+func options() *template.Options {
+	o := &template.Options{LeftDelim: *leftDelim, RightDelim: *rightDelim}
+	if *mustache {
+		o = template.MustacheOptions()
+	}
+	o.KebabCase = *kebab
+
+	return o
+}
+
+// processFile formats the file at filename. If in is nil the file
+// is read from disk.
+func processFile(filename string, in io.Reader, out io.Writer) error {
+	if in == nil {
+		f, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	src, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	res, err := template.Format(filename, options(), src)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(src, res) {
+		if *list {
+			fmt.Fprintln(out, filename)
+		}
+		if *write {
+			info, err := os.Stat(filename)
+			if err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(filename, res, info.Mode().Perm()); err != nil {
+				return err
+			}
+		}
+		if *doDiff {
+			fmt.Fprintf(out, "diff %s tmplfmt/%s\n", filename, filename)
+			out.Write(diff(filename, src, res))
+		}
+	}
+
+	if !*list && !*write && !*doDiff {
+		_, err = out.Write(res)
+	}
+
+	return err
+}
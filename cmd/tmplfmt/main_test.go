@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// setFlag sets the flag p to v for the duration of the test.
+func setFlag(t *testing.T, p *bool, v bool) {
+	prev := *p
+	*p = v
+	t.Cleanup(func() { *p = prev })
+}
+
+func writeFile(t *testing.T, src string) string {
+	fn := filepath.Join(t.TempDir(), "a.tmpl")
+	if err := ioutil.WriteFile(fn, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fn
+}
+
+const (
+	unformatted = "((# a ))\n(( b ))\n((/a))\n"
+	formatted   = "((#a))\n((b))\n((/a))\n"
+)
+
+func TestProcessFile(t *testing.T) {
+	var out bytes.Buffer
+	if err := processFile("<standard input>", strings.NewReader(unformatted), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != formatted {
+		t.Errorf("got %q", out.String())
+	}
+}
+
+func TestProcessFileList(t *testing.T) {
+	setFlag(t, list, true)
+
+	fn := writeFile(t, unformatted)
+	var out bytes.Buffer
+	if err := processFile(fn, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != fn+"\n" {
+		t.Errorf("got %q", out.String())
+	}
+
+	out.Reset()
+	if err := processFile(fn, strings.NewReader(formatted), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("formatted file was listed: %q", out.String())
+	}
+}
+
+func TestProcessFileWrite(t *testing.T) {
+	setFlag(t, write, true)
+
+	fn := writeFile(t, unformatted)
+	var out bytes.Buffer
+	if err := processFile(fn, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Len() != 0 {
+		t.Errorf("unexpected output %q", out.String())
+	}
+
+	b, err := os.ReadFile(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != formatted {
+		t.Errorf("file has %q", b)
+	}
+}
+
+func TestProcessFileDiff(t *testing.T) {
+	setFlag(t, doDiff, true)
+
+	fn := writeFile(t, unformatted)
+	var out bytes.Buffer
+	if err := processFile(fn, nil, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "diff " + fn + " tmplfmt/" + fn + "\n--- " + fn + ".orig\n+++ " + fn + "\n" +
+		"@@ -1,3 +1,3 @@\n-((# a ))\n-(( b ))\n+((#a))\n+((b))\n ((/a))\n"
+	if out.String() != expected {
+		t.Errorf("got\n%s\nexpected\n%s", out.String(), expected)
+	}
+
+	// The file is not changed.
+	if b, err := os.ReadFile(fn); err != nil || string(b) != unformatted {
+		t.Errorf("file has %q, %v", b, err)
+	}
+}
+
+func TestProcessFileError(t *testing.T) {
+	if err := processFile("bad", strings.NewReader("((#a))"), &bytes.Buffer{}); err == nil {
+		t.Error("expected a parse error")
+	}
+}
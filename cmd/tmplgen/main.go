@@ -0,0 +1,184 @@
+// Command tmplgen compiles a directory of templates to Go source code.
+//
+// Usage:
+//
+//	tmplgen [flags] -type import/path.Type dir
+//
+// Every file in dir with a matching extension is loaded. Templates are
+// named by their slash-separated path relative to dir, as ParseFiles
+// names them. The generated package has a function for each template
+// that renders it with data of the given type, which may be a pointer
+// type like *import/path.Type:
+//
+//	func RenderUsersList(w io.Writer, data *path.Type) error
+//
+// The data type is inspected by a temporary program that tmplgen builds
+// and runs in the current directory, which must be inside the module or
+// GOPATH workspace of the type's package. It's meant to be used with
+// go generate:
+//
+//	//go:generate tmplgen -pkg views -o views.go -type example.com/app/data.*Page ./templates
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/FSX/template/internal/tmplfile"
+)
+
+var (
+	leftDelim  = flag.String("left", "", "left delimiter")
+	rightDelim = flag.String("right", "", "right delimiter")
+	stripExt   = flag.Bool("strip", false, "strip file extensions from template names")
+	extensions = flag.String("ext", ".tmpl,.html,.mustache", "extensions of template files")
+	dataType   = flag.String("type", "", "data type of the templates, e.g. example.com/app/data.*Page")
+	pkgName    = flag.String("pkg", "views", "name of the generated package")
+	pkgPath    = flag.String("pkgpath", "", "import path of the generated package, if it's the package of the data type")
+	output     = flag.String("o", "", "write the generated code to this file instead of stdout")
+	mustache   = flag.Bool("mustache", false, "parse standard Mustache templates; -left and -right are ignored")
+	kebab      = flag.Bool("kebab", false, "allow hyphens in identifiers, like created-at")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: tmplgen [flags] -type import/path.Type dir\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() != 1 || *dataType == "" {
+		usage()
+		os.Exit(2)
+	}
+
+	if err := run(flag.Arg(0)); err != nil {
+		fmt.Fprintln(os.Stderr, "tmplgen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(dir string) error {
+	sources, err := readDir(dir)
+	if err != nil {
+		return err
+	}
+
+	src, err := bootstrap(sources)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempDir(".", "tmplgen_bootstrap")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := ioutil.WriteFile(filepath.Join(tmp, "main.go"), src, 0644); err != nil {
+		return err
+	}
+
+	var stdout bytes.Buffer
+	cmd := exec.Command("go", "run", "."+string(filepath.Separator)+filepath.Base(tmp))
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+
+	if *output == "" {
+		_, err = os.Stdout.Write(stdout.Bytes())
+		return err
+	}
+
+	return ioutil.WriteFile(*output, stdout.Bytes(), 0644)
+}
+
+// bootstrap returns the source of a program that parses sources and
+// writes the generated code to stdout.
+func bootstrap(sources map[string]string) ([]byte, error) {
+	typ := *dataType
+	pointer := strings.HasPrefix(typ, "*")
+	typ = strings.TrimPrefix(typ, "*")
+
+	i := strings.LastIndex(typ, ".")
+	if i < 0 || strings.Contains(typ[i:], "/") {
+		return nil, fmt.Errorf("invalid type %q, expected import/path.Type", *dataType)
+	}
+	path, name := typ[:i], typ[i+1:]
+
+	if j := strings.LastIndex(name, "*"); j >= 0 {
+		// Allow the pointer on the type name, e.g. import/path.*Type.
+		pointer, name = true, name[j+1:]
+	}
+
+	typeExpr := "reflect.TypeOf((*data." + name + ")(nil)).Elem()"
+	if pointer {
+		typeExpr = "reflect.TypeOf((*data." + name + ")(nil))"
+	}
+
+	var names []string
+	for n := range sources {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "package main\n\nimport (\n\t\"fmt\"\n\t\"os\"\n\t\"reflect\"\n\n\t\"github.com/FSX/template\"\n\tdata %s\n)\n\n", strconv.Quote(path))
+	b.WriteString("var sources = map[string]string{\n")
+	for _, n := range names {
+		fmt.Fprintf(&b, "\t%s: %s,\n", strconv.Quote(n), strconv.Quote(sources[n]))
+	}
+	b.WriteString("}\n\n")
+	b.WriteString("func main() {\n\ttyp := " + typeExpr + "\n")
+	b.WriteString("\tm := make(map[string]template.Node)\n\ttypes := make(map[string]reflect.Type)\n\n")
+	if *mustache {
+		b.WriteString("\toptions := template.MustacheOptions()\n")
+	} else {
+		fmt.Fprintf(&b, "\toptions := &template.Options{LeftDelim: %s, RightDelim: %s}\n", strconv.Quote(*leftDelim), strconv.Quote(*rightDelim))
+	}
+	fmt.Fprintf(&b, "\toptions.KebabCase = %t\n\n", *kebab)
+	b.WriteString("\tfor name, src := range sources {\n\t\tn, err := template.ParseOptions(name, options, src)\n")
+	b.WriteString("\t\tif err != nil {\n\t\t\tfmt.Fprintln(os.Stderr, err)\n\t\t\tos.Exit(1)\n\t\t}\n\t\tm[name] = n\n\t\ttypes[name] = typ\n\t}\n\n")
+	b.WriteString("\tt := template.New(template.NewNodeMap(m))\n")
+	fmt.Fprintf(&b, "\terr := t.Generate(os.Stdout, &template.GenerateOptions{Package: %s, PkgPath: %s, Types: types})\n", strconv.Quote(*pkgName), strconv.Quote(*pkgPath))
+	b.WriteString("\tif err != nil {\n\t\tfmt.Fprintln(os.Stderr, err)\n\t\tos.Exit(1)\n\t}\n}\n")
+
+	return b.Bytes(), nil
+}
+
+// readDir reads all template files in dir, keyed by template name.
+func readDir(dir string) (map[string]string, error) {
+	filenames, err := tmplfile.Find(dir, strings.Split(*extensions, ","))
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make(map[string]string, len(filenames))
+	for _, fn := range filenames {
+		b, err := ioutil.ReadFile(filepath.Join(dir, fn))
+		if err != nil {
+			return nil, err
+		}
+
+		name := filepath.ToSlash(fn)
+		if *stripExt {
+			name = tmplfile.StripExtension(name)
+		}
+
+		sources[name] = string(b)
+	}
+
+	return sources, nil
+}
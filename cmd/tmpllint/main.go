@@ -0,0 +1,102 @@
+// Command tmpllint reports problems in a directory of templates.
+//
+// Usage:
+//
+//	tmpllint [flags] dir
+//
+// Every file in dir with a matching extension is loaded. Templates are
+// named by their slash-separated path relative to dir, as ParseFiles
+// names them. Each problem is printed as
+//
+//	name:line:column: message (check)
+//
+// The exit code is 1 if any problems were found and 2 on other errors.
+// With -mustache the templates are parsed as standard Mustache, like
+// MustacheOptions, and -left and -right are ignored.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/FSX/template"
+	"github.com/FSX/template/internal/tmplfile"
+)
+
+var (
+	leftDelim  = flag.String("left", "", "left delimiter")
+	rightDelim = flag.String("right", "", "right delimiter")
+	mustache   = flag.Bool("mustache", false, "parse standard Mustache templates")
+	kebab      = flag.Bool("kebab", false, "allow hyphens in identifiers, like created-at")
+	stripExt   = flag.Bool("strip", false, "strip file extensions from template names")
+	maxDepth   = flag.Int("max-depth", 4, "maximum depth of nested sections; 0 disables the check")
+	extensions = flag.String("ext", ".tmpl,.html,.mustache", "extensions of template files")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: tmpllint [flags] dir\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		usage()
+		os.Exit(2)
+	}
+
+	sources, err := readDir(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	options := &template.Options{LeftDelim: *leftDelim, RightDelim: *rightDelim}
+	if *mustache {
+		options = template.MustacheOptions()
+	}
+	options.KebabCase = *kebab
+
+	l := template.NewLinter(options)
+	l.MaxDepth = *maxDepth
+
+	problems := l.Lint(sources)
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+
+	if len(problems) > 0 {
+		os.Exit(1)
+	}
+}
+
+// readDir reads all template files in dir, keyed by template name.
+func readDir(dir string) (map[string]string, error) {
+	filenames, err := tmplfile.Find(dir, strings.Split(*extensions, ","))
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make(map[string]string, len(filenames))
+	for _, fn := range filenames {
+		b, err := ioutil.ReadFile(filepath.Join(dir, fn))
+		if err != nil {
+			return nil, err
+		}
+
+		name := filepath.ToSlash(fn)
+		if *stripExt {
+			name = tmplfile.StripExtension(name)
+		}
+
+		sources[name] = string(b)
+	}
+
+	return sources, nil
+}
@@ -1,80 +1,288 @@
 package template
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"strconv"
 	"strings"
 )
 
-func PrintNodes(node Node, level int) {
+// DumpFormat selects the output format of Dump.
+type DumpFormat int
+
+const (
+	DumpText DumpFormat = iota // Indented tree, one node per line.
+	DumpJSON                   // Nested JSON objects.
+	DumpDOT                    // Graphviz DOT graph.
+)
+
+// Dump writes a complete description of the tree of nodes to w. Nothing
+// is truncated and every node includes its byte position in the input.
+func Dump(w io.Writer, node Node, format DumpFormat) error {
+	switch format {
+	case DumpText:
+		d := &textDumper{w: w}
+		d.dump(node, 0, "")
+		return d.err
+	case DumpJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(newJSONNode(node))
+	case DumpDOT:
+		d := &dotDumper{w: w}
+		d.printf("digraph nodes {\n\tnode [shape=box, fontname=monospace];\n")
+		d.dump(node)
+		d.printf("}\n")
+		return d.err
+	}
+
+	return fmt.Errorf("template: unknown dump format: %d", format)
+}
+
+// nodeType returns the type name of a node, e.g. "sectionNode".
+func nodeType(node Node) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", node), "*template.")
+}
+
+// nodeLabel returns the short description of a node that is
+// shown next to its type name, without its children.
+func nodeLabel(node Node) string {
+	switch n := node.(type) {
+	case *textNode:
+		return fmt.Sprintf("%q", n.Text)
+	case *commentNode:
+		return fmt.Sprintf("%q", n.Text)
+	case *stringNode:
+		return fmt.Sprintf("%q", n.Text)
+	case *numberNode:
+		return n.Text
+	case *boolNode:
+		return strconv.FormatBool(n.True)
+	case *mapNode:
+		return fmt.Sprintf("%q", n.Keys)
+	case *binaryNode:
+		return n.Op
+	case *unaryNode:
+		return n.Op
+	case *sectionNode:
+		label := fmt.Sprintf("inverted=%t %s", n.Inverted, n.Name())
+		if n.Chained {
+			label += " chained"
+		}
+		return label
+	case *variableNode:
+		switch {
+		case n.Raw:
+			return "raw"
+		case n.Escape:
+			return "escape"
+		}
+		return ""
+	case *partialNode:
+		label := partialString(n)
+		if n.Indent != "" {
+			label += fmt.Sprintf(" indent=%q", n.Indent)
+		}
+		if n.Optional {
+			label += " optional"
+		}
+		return label
+	case NamedNode:
+		return n.Name()
+	}
+
+	return ""
+}
+
+// nodeArgs returns the expression of a node that has one, or the
+// operands of an operator.
+func nodeArgs(node Node) (head Node, tail []Node) {
+	switch n := node.(type) {
+	case ExpressionNode:
+		return n.Expression()
+	case *binaryNode:
+		return n.Left, []Node{n.Right}
+	case *unaryNode:
+		return n.Operand, nil
+	case *sliceNode:
+		return firstRest(n.Items)
+	case *mapNode:
+		return firstRest(n.Values)
+	}
+
+	return nil, nil
+}
+
+// firstRest splits the elements of a list or map literal.
+func firstRest(nodes []Node) (Node, []Node) {
+	if len(nodes) == 0 {
+		return nil, nil
+	}
+	return nodes[0], nodes[1:]
+}
+
+type textDumper struct {
+	w   io.Writer
+	err error
+}
+
+func (d *textDumper) dump(node Node, level int, prefix string) {
+	if d.err != nil {
+		return
+	}
+
 	s := strings.Repeat("    ", level)
+	if label := nodeLabel(node); label != "" {
+		_, d.err = fmt.Fprintf(d.w, "%s%s(%s @%d: %s)\n", s, prefix, nodeType(node), node.Position(), label)
+	} else {
+		_, d.err = fmt.Fprintf(d.w, "%s%s(%s @%d)\n", s, prefix, nodeType(node), node.Position())
+	}
 
-	switch t := node.(type) {
-	case (*listNode):
-		fmt.Printf("%s(listNode)\n", s)
-		for _, n := range t.Children() {
-			PrintNodes(n, level+1)
+	if head, tail := nodeArgs(node); head != nil {
+		d.dump(head, level+1, "| ")
+		for _, n := range tail {
+			d.dump(n, level+1, "| ")
 		}
-	case (*inheritNode):
-		fmt.Printf("%s(inheritNode: %s)\n", s, t.Name())
+	}
 
-		for _, n := range t.Children() {
-			PrintNodes(n, level+1)
+	if p, ok := node.(ParentNode); ok {
+		for _, n := range p.Children() {
+			d.dump(n, level+1, "")
 		}
-	case (*defineNode):
-		fmt.Printf("%s(defineNode: %s)\n", s, t.Name())
+	}
 
-		for _, n := range t.Children() {
-			PrintNodes(n, level+1)
+	if s, ok := node.(*sectionNode); ok && s.Else != nil {
+		d.dump(s.Else, level+1, "else ")
+	}
+}
+
+// jsonNode is the JSON representation of a node.
+type jsonNode struct {
+	Type     string      `json:"type"`
+	Pos      Pos         `json:"pos"`
+	Name     string      `json:"name,omitempty"`
+	Op       string      `json:"op,omitempty"`
+	Text     *string     `json:"text,omitempty"`
+	Keys     []string    `json:"keys,omitempty"`
+	Inverted *bool       `json:"inverted,omitempty"`
+	Chained  bool        `json:"chained,omitempty"`
+	Escape   bool        `json:"escape,omitempty"`
+	Raw      bool        `json:"raw,omitempty"`
+	Indent   string      `json:"indent,omitempty"`
+	Optional bool        `json:"optional,omitempty"`
+	Context  *jsonNode   `json:"context,omitempty"`
+	Params   []jsonParam `json:"params,omitempty"`
+	Head     *jsonNode   `json:"head,omitempty"`
+	Tail     []*jsonNode `json:"tail,omitempty"`
+	Children []*jsonNode `json:"children,omitempty"`
+	Else     *jsonNode   `json:"else,omitempty"`
+}
+
+// jsonParam is the JSON representation of a parameter of a partial.
+type jsonParam struct {
+	Key   string    `json:"key"`
+	Value *jsonNode `json:"value"`
+}
+
+func newJSONNode(node Node) *jsonNode {
+	j := &jsonNode{Type: nodeType(node), Pos: node.Position()}
+
+	switch n := node.(type) {
+	case *textNode:
+		j.Text = &n.Text
+	case *commentNode:
+		j.Text = &n.Text
+	case *stringNode:
+		j.Text = &n.Text
+	case *numberNode:
+		j.Text = &n.Text
+	case *boolNode:
+		text := strconv.FormatBool(n.True)
+		j.Text = &text
+	case *mapNode:
+		j.Keys = n.Keys
+	case *binaryNode:
+		j.Op = n.Op
+	case *unaryNode:
+		j.Op = n.Op
+	case *sectionNode:
+		j.Name = n.Name()
+		j.Inverted = &n.Inverted
+		j.Chained = n.Chained
+		if n.Else != nil {
+			j.Else = newJSONNode(n.Else)
 		}
-	case (*sectionNode):
-		fmt.Printf("%s(sectionNode inverted=%t: %s)\n", s, t.Inverted, t.Name())
-
-		printPipe(level + 1)
-		PrintNodes(t.Head, 0)
-		for _, n := range t.Tail {
-			printPipe(level + 1)
-			PrintNodes(n, 0)
+	case *variableNode:
+		j.Escape, j.Raw = n.Escape, n.Raw
+	case *partialNode:
+		j.Name, j.Indent, j.Optional = n.Name(), n.Indent, n.Optional
+		if n.Context != nil {
+			j.Context = newJSONNode(n.Context)
 		}
-		for _, n := range t.Children() {
-			PrintNodes(n, level+1)
+		for _, p := range n.Params {
+			j.Params = append(j.Params, jsonParam{p.Key, newJSONNode(p.Value)})
 		}
-	case (*textNode):
-		if len(t.Text) > 10 {
-			fmt.Printf("%s(textNode: %.10q...)\n", s, t.Text)
-		} else {
-			fmt.Printf("%s(textNode: %q)\n", s, t.Text)
+	case NamedNode:
+		j.Name = n.Name()
+	}
+
+	if head, tail := nodeArgs(node); head != nil {
+		j.Head = newJSONNode(head)
+		for _, n := range tail {
+			j.Tail = append(j.Tail, newJSONNode(n))
 		}
-	case (*commentNode):
-		if len(t.Text) > 10 {
-			fmt.Printf("%s(commentNode: %.10q...)\n", s, t.Text)
-		} else {
-			fmt.Printf("%s(commentNode: %q)\n", s, t.Text)
+	}
+
+	if p, ok := node.(ParentNode); ok {
+		for _, n := range p.Children() {
+			j.Children = append(j.Children, newJSONNode(n))
 		}
-	case (*variableNode):
-		fmt.Printf("%s(variableNode)\n", s)
-
-		printPipe(level + 1)
-		PrintNodes(t.Head, 0)
-		for _, n := range t.Tail {
-			printPipe(level + 1)
-			PrintNodes(n, 0)
+	}
+
+	return j
+}
+
+type dotDumper struct {
+	w   io.Writer
+	id  int
+	err error
+}
+
+func (d *dotDumper) printf(format string, args ...interface{}) {
+	if d.err == nil {
+		_, d.err = fmt.Fprintf(d.w, format, args...)
+	}
+}
+
+// dump writes the node and its descendants and returns the
+// identifier of the node in the graph.
+func (d *dotDumper) dump(node Node) string {
+	id := fmt.Sprintf("n%d", d.id)
+	d.id++
+
+	label := fmt.Sprintf("%s @%d", nodeType(node), node.Position())
+	if l := nodeLabel(node); l != "" {
+		label += "\n" + l
+	}
+	d.printf("\t%s [label=%q];\n", id, label)
+
+	if head, tail := nodeArgs(node); head != nil {
+		d.printf("\t%s -> %s [label=\"head\", style=dashed];\n", id, d.dump(head))
+		for i, n := range tail {
+			d.printf("\t%s -> %s [label=\"tail %d\", style=dashed];\n", id, d.dump(n), i)
 		}
-	case (*identifierNode):
-		fmt.Printf("%s(identifierNode: %s)\n", s, t.Name())
-	case (*stringNode):
-		if len(t.Text) > 10 {
-			fmt.Printf("%s(stringNode: %.10q...)\n", s, t.Text)
-		} else {
-			fmt.Printf("%s(stringNode: %q)\n", s, t.Text)
+	}
+
+	if p, ok := node.(ParentNode); ok {
+		for _, n := range p.Children() {
+			d.printf("\t%s -> %s;\n", id, d.dump(n))
 		}
-	case (*numberNode):
-		fmt.Printf("%s(numberNode: %s)\n", s, t.Text)
-	case (*partialNode):
-		fmt.Printf("%s(partialNode: %s)\n", s, t.Name())
 	}
-}
 
-func printPipe(level int) {
-	s := strings.Repeat("    ", level)
-	fmt.Printf("%s| ", s)
+	if s, ok := node.(*sectionNode); ok && s.Else != nil {
+		d.printf("\t%s -> %s [label=\"else\"];\n", id, d.dump(s.Else))
+	}
+
+	return id
 }
@@ -0,0 +1,172 @@
+package template
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const dumpInput = `a((#s x "y"))((v))((/s))((! c ))((<base))(($t))T((/t))((/base))((>p))`
+
+const dumpText = `(listNode @0)
+    (textNode @0: "a")
+    (sectionNode @1: inverted=false s)
+        | (identifierNode @4: s)
+        | (identifierNode @6: x)
+        | (stringNode @8: "y")
+        (variableNode @13)
+            | (identifierNode @15: v)
+    (commentNode @24: " c ")
+    (inheritNode @32: base)
+        (defineNode @41: t)
+            (textNode @47: "T")
+    (partialNode @63: p)
+`
+
+func TestDumpText(t *testing.T) {
+	n, err := Parse("dump", "", "", dumpInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := Dump(&buf, n, DumpText); err != nil {
+		t.Fatal(err)
+	}
+
+	if r := buf.String(); r != dumpText {
+		t.Errorf("got\n%s\nexpected\n%s", r, dumpText)
+	}
+}
+
+func TestDumpOperators(t *testing.T) {
+	n, err := Parse("dump", "", "", "((-a || f b))")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := Dump(&buf, n, DumpText); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `(listNode @0)
+    (variableNode @0)
+        | (binaryNode @5: ||)
+            | (unaryNode @2: -)
+                | (identifierNode @3: a)
+            | (callNode @8)
+                | (identifierNode @8: f)
+                | (identifierNode @10: b)
+`
+	if r := buf.String(); r != expected {
+		t.Errorf("got\n%s\nexpected\n%s", r, expected)
+	}
+}
+
+func TestDumpLiterals(t *testing.T) {
+	n, err := Parse("dump", "", "", `((f [a, nil] {k: true}))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := Dump(&buf, n, DumpText); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `(listNode @0)
+    (variableNode @0)
+        | (identifierNode @2: f)
+        | (sliceNode @4)
+            | (identifierNode @5: a)
+            | (nilNode @8)
+        | (mapNode @13: ["k"])
+            | (boolNode @17: true)
+`
+	if r := buf.String(); r != expected {
+		t.Errorf("got\n%s\nexpected\n%s", r, expected)
+	}
+}
+
+func TestDumpElse(t *testing.T) {
+	n, err := Parse("dump", "", "", "((#a))x((else #b))y((/a))")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := Dump(&buf, n, DumpText); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `(listNode @0)
+    (sectionNode @0: inverted=false a)
+        | (identifierNode @3: a)
+        (textNode @6: "x")
+        else (listNode @7)
+            (sectionNode @14: inverted=false b chained)
+                | (identifierNode @15: b)
+                (textNode @18: "y")
+`
+	if r := buf.String(); r != expected {
+		t.Errorf("got\n%s\nexpected\n%s", r, expected)
+	}
+}
+
+func TestDumpJSON(t *testing.T) {
+	n, err := Parse("dump", "", "", dumpInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := Dump(&buf, n, DumpJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	var root jsonNode
+	if err := json.Unmarshal(buf.Bytes(), &root); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(root.Children) != 5 {
+		t.Fatalf("got %d children, expected 5", len(root.Children))
+	}
+
+	s := root.Children[1]
+	if s.Type != "sectionNode" || s.Pos != 1 || s.Inverted == nil || *s.Inverted || len(s.Tail) != 2 {
+		t.Errorf("unexpected section: %+v", s)
+	}
+
+	if c := root.Children[2]; c.Text == nil || *c.Text != " c " || c.Pos != 24 {
+		t.Errorf("unexpected comment: %+v", c)
+	}
+}
+
+func TestDumpDOT(t *testing.T) {
+	n, err := Parse("dump", "", "", dumpInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := Dump(&buf, n, DumpDOT); err != nil {
+		t.Fatal(err)
+	}
+
+	r := buf.String()
+	if !strings.HasPrefix(r, "digraph nodes {") || !strings.HasSuffix(r, "}\n") {
+		t.Errorf("not a graph:\n%s", r)
+	}
+	if c := strings.Count(r, "->"); c != 12 {
+		t.Errorf("got %d edges, expected 12", c)
+	}
+}
+
+func TestDumpUnknownFormat(t *testing.T) {
+	if err := Dump(&bytes.Buffer{}, newList(0), DumpFormat(-1)); err == nil {
+		t.Error("expected error; got none")
+	}
+}
@@ -0,0 +1,406 @@
+package template
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+)
+
+// Binary format of an encoded tree:
+//
+//	magic    "TMPL"
+//	version  uvarint
+//	root     node
+//	checksum uint32, CRC-32 (IEEE) of everything before it, big endian
+//
+// A node is its NodeType and position as uvarints, followed by its
+// fields. Strings and lists are prefixed with their length as a uvarint.
+
+const (
+	encodeMagic   = "TMPL"
+	encodeVersion = 11
+)
+
+// ErrBadEncoding is returned when a tree cannot be decoded, because
+// the data is corrupt or written by an incompatible version.
+var ErrBadEncoding = errors.New("template: bad tree encoding")
+
+// MarshalTree encodes a parsed tree to a compact binary format.
+func MarshalTree(node Node) ([]byte, error) {
+	e := &encoder{}
+	e.buf.WriteString(encodeMagic)
+	e.uvarint(encodeVersion)
+	e.node(node)
+
+	if e.err != nil {
+		return nil, e.err
+	}
+
+	b := e.buf.Bytes()
+	return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(b)), nil
+}
+
+// UnmarshalTree decodes a tree encoded by MarshalTree.
+func UnmarshalTree(data []byte) (ParentNode, error) {
+	if len(data) < len(encodeMagic)+4 || string(data[:len(encodeMagic)]) != encodeMagic {
+		return nil, ErrBadEncoding
+	}
+
+	body, sum := data[:len(data)-4], binary.BigEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return nil, ErrBadEncoding
+	}
+
+	d := &decoder{data: body[len(encodeMagic):]}
+	if v := d.uvarint(); v != encodeVersion {
+		return nil, fmt.Errorf("%w: version %d, expected %d", ErrBadEncoding, v, encodeVersion)
+	}
+
+	root, ok := d.node().(*listNode)
+	if d.err != nil {
+		return nil, d.err
+	}
+	if !ok || len(d.data) != 0 {
+		return nil, ErrBadEncoding
+	}
+
+	return root, nil
+}
+
+type encoder struct {
+	buf bytes.Buffer
+	err error
+}
+
+func (e *encoder) uvarint(v uint64) {
+	e.buf.Write(binary.AppendUvarint(nil, v))
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.buf.WriteString(s)
+}
+
+func (e *encoder) bool(b bool) {
+	if b {
+		e.buf.WriteByte(1)
+	} else {
+		e.buf.WriteByte(0)
+	}
+}
+
+func (e *encoder) nodes(nodes []Node) {
+	e.uvarint(uint64(len(nodes)))
+	for _, n := range nodes {
+		e.node(n)
+	}
+}
+
+func (e *encoder) node(node Node) {
+	e.uvarint(uint64(node.Type()))
+	e.uvarint(uint64(node.Position()))
+
+	switch n := node.(type) {
+	case *listNode:
+		e.nodes(n.Children())
+	case *textNode:
+		e.string(n.Text)
+	case *commentNode:
+		e.string(n.Text)
+		e.bool(n.Delims)
+	case *variableNode:
+		e.node(n.Head)
+		e.nodes(n.Tail)
+		e.bool(n.Escape)
+		e.bool(n.Raw)
+	case *sectionNode:
+		e.bool(n.Inverted)
+		e.node(n.Head)
+		e.nodes(n.Tail)
+		e.nodes(n.Children())
+		e.bool(n.PushMap)
+		e.bool(n.Chained)
+		e.bool(n.Else != nil)
+		if n.Else != nil {
+			e.node(n.Else)
+		}
+	case *letNode:
+		e.string(n.Name())
+		e.node(n.Head)
+		e.nodes(n.Tail)
+	case *partialNode:
+		e.string(n.Name())
+		e.string(n.Indent)
+		e.bool(n.Optional)
+		e.bool(n.Dynamic != nil)
+		if n.Dynamic != nil {
+			e.node(n.Dynamic)
+		}
+		e.bool(n.Context != nil)
+		if n.Context != nil {
+			e.node(n.Context)
+		}
+		e.uvarint(uint64(len(n.Params)))
+		for _, p := range n.Params {
+			e.string(p.Key)
+			e.node(p.Value)
+		}
+	case *inheritNode:
+		e.string(n.Name())
+		e.nodes(n.Children())
+	case *defineNode:
+		e.string(n.Name())
+		e.nodes(n.Children())
+	case *identifierNode:
+		e.uvarint(uint64(len(n.path)))
+		for _, s := range n.path {
+			e.string(s)
+		}
+	case *stringNode:
+		e.string(n.Quoted)
+	case *numberNode:
+		e.string(n.Text)
+	case *boolNode:
+		e.bool(n.True)
+	case *nilNode:
+	case *sliceNode:
+		e.nodes(n.Items)
+	case *mapNode:
+		e.uvarint(uint64(len(n.Keys)))
+		for i, key := range n.Keys {
+			e.string(key)
+			e.node(n.Values[i])
+		}
+	case *binaryNode:
+		e.string(n.Op)
+		e.node(n.Left)
+		e.node(n.Right)
+	case *unaryNode:
+		e.string(n.Op)
+		e.node(n.Operand)
+	case *callNode:
+		e.node(n.Func)
+		e.nodes(n.Args)
+	default:
+		if e.err == nil {
+			e.err = fmt.Errorf("template: cannot encode node of type %s", node.Type())
+		}
+	}
+}
+
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) fail() {
+	if d.err == nil {
+		d.err = ErrBadEncoding
+	}
+	d.data = nil
+}
+
+func (d *decoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+// length reads a length that can be at most the number of bytes left,
+// as every element takes at least one byte.
+func (d *decoder) length() int {
+	n := d.uvarint()
+	if n > uint64(len(d.data)) {
+		d.fail()
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) string() string {
+	n := d.length()
+	s := string(d.data[:n])
+	d.data = d.data[n:]
+	return s
+}
+
+func (d *decoder) bool() bool {
+	if len(d.data) == 0 {
+		d.fail()
+		return false
+	}
+	b := d.data[0]
+	d.data = d.data[1:]
+	return b == 1
+}
+
+func (d *decoder) nodes() []Node {
+	n := d.length()
+	if n == 0 {
+		return nil
+	}
+
+	nodes := make([]Node, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		nodes = append(nodes, d.node())
+	}
+	return nodes
+}
+
+func (d *decoder) appendAll(parent ParentNode) {
+	for _, n := range d.nodes() {
+		parent.Append(n)
+	}
+}
+
+func (d *decoder) node() Node {
+	typ := NodeType(d.uvarint())
+	pos := Pos(d.uvarint())
+	if d.err != nil {
+		return nil
+	}
+
+	switch typ {
+	case NodeList:
+		n := newList(pos)
+		d.appendAll(n)
+		return n
+	case NodeText:
+		return newText(pos, d.string())
+	case NodeComment:
+		n := newComment(pos, d.string())
+		n.Delims = d.bool()
+		return n
+	case NodeVariable:
+		head := d.node()
+		n := newVariable(pos, head, d.nodes())
+		n.Escape = d.bool()
+		n.Raw = d.bool()
+		return n
+	case NodeSection:
+		inverted := d.bool()
+		head := d.node()
+		if head == nil {
+			d.fail()
+			return nil
+		}
+		n := newSection(pos, head, d.nodes(), inverted)
+		d.appendAll(n)
+		n.PushMap = d.bool()
+		n.Chained = d.bool()
+		if d.bool() {
+			l, ok := d.node().(*listNode)
+			if !ok {
+				d.fail()
+				return nil
+			}
+			n.Else = l
+		}
+		return n
+	case NodeLet:
+		name := d.string()
+		head := d.node()
+		if head == nil {
+			d.fail()
+			return nil
+		}
+		return newLet(pos, name, head, d.nodes())
+	case NodePartial:
+		n := newPartial(pos, d.string())
+		n.Indent = d.string()
+		n.Optional = d.bool()
+		if d.bool() {
+			id, ok := d.node().(*identifierNode)
+			if !ok {
+				d.fail()
+				return nil
+			}
+			n.Dynamic = id
+		}
+		if d.bool() {
+			n.Context = d.node()
+		}
+		for i, l := 0, d.length(); i < l && d.err == nil; i++ {
+			n.Params = append(n.Params, param{d.string(), d.node()})
+		}
+		return n
+	case NodeInherit:
+		n := newInherit(pos, d.string())
+		d.appendAll(n)
+		return n
+	case NodeDefine:
+		n := newDefine(pos, d.string())
+		d.appendAll(n)
+		return n
+	case NodeIdentifier:
+		path := make([]string, d.length())
+		for i := range path {
+			path[i] = d.string()
+		}
+		if len(path) == 0 {
+			d.fail()
+			return nil
+		}
+		return newIdentifier(pos, path)
+	case NodeString:
+		quoted := d.string()
+		text, err := strconv.Unquote(quoted)
+		if err != nil {
+			d.fail()
+			return nil
+		}
+		return newString(pos, quoted, text)
+	case NodeNumber:
+		return newNumber(pos, d.string())
+	case NodeBool:
+		return newBool(pos, d.bool())
+	case NodeNil:
+		return newNil(pos)
+	case NodeListLiteral:
+		return newSlice(pos, d.nodes())
+	case NodeMapLiteral:
+		var (
+			keys   []string
+			values []Node
+		)
+		for i, n := 0, d.length(); i < n && d.err == nil; i++ {
+			keys = append(keys, d.string())
+			values = append(values, d.node())
+		}
+		return newMap(pos, keys, values)
+	case NodeBinary:
+		op := d.string()
+		left := d.node()
+		right := d.node()
+		if left == nil || right == nil || binaryPrecedence[op] == 0 {
+			d.fail()
+			return nil
+		}
+		return newBinary(pos, op, left, right)
+	case NodeUnary:
+		op := d.string()
+		operand := d.node()
+		if operand == nil || op != "!" && op != "-" {
+			d.fail()
+			return nil
+		}
+		return newUnary(pos, op, operand)
+	case NodeCall:
+		fn, ok := d.node().(*identifierNode)
+		if !ok {
+			d.fail()
+			return nil
+		}
+		return newCall(pos, fn, d.nodes())
+	}
+
+	d.fail()
+	return nil
+}
@@ -0,0 +1,126 @@
+package template
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMarshalTree(t *testing.T) {
+	inputs := []string{"", dumpInput, benchmarkParseTmpl}
+	for _, test := range printTests {
+		inputs = append(inputs, test.input)
+	}
+
+	mustache := map[string]bool{"{{{a}}} {{b}}\n  {{>c}}\n": true}
+	for input := range mustache {
+		inputs = append(inputs, input)
+	}
+
+	for _, input := range inputs {
+		options := &Options{}
+		if mustache[input] {
+			options = MustacheOptions()
+		}
+
+		n1, err := ParseOptions("encode", options, input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := MarshalTree(n1)
+		if err != nil {
+			t.Fatalf("%q: %v", input, err)
+		}
+
+		n2, err := UnmarshalTree(b)
+		if err != nil {
+			t.Fatalf("%q: %v", input, err)
+		}
+
+		if !reflect.DeepEqual(n1, n2) {
+			t.Errorf("%q: tree changed after encoding", input)
+		}
+	}
+}
+
+func TestUnmarshalTreeBad(t *testing.T) {
+	n, _ := Parse("encode", "", "", dumpInput)
+	b, _ := MarshalTree(n)
+
+	corrupt := append([]byte(nil), b...)
+	corrupt[len(corrupt)/2] ^= 0xff
+
+	// Valid checksum, but another version.
+	version := append([]byte(encodeMagic), binary.AppendUvarint(nil, encodeVersion+1)...)
+	version = append(version, b[len(encodeMagic)+1:len(b)-4]...)
+	version = binary.BigEndian.AppendUint32(version, crc32.ChecksumIEEE(version))
+
+	tests := map[string][]byte{
+		"empty":     nil,
+		"truncated": b[:len(b)-5],
+		"corrupt":   corrupt,
+		"version":   version,
+	}
+
+	for name, data := range tests {
+		if _, err := UnmarshalTree(data); !errors.Is(err, ErrBadEncoding) {
+			t.Errorf("%s: got %v, expected ErrBadEncoding", name, err)
+		}
+	}
+}
+
+func TestParseFilesCache(t *testing.T) {
+	dir := t.TempDir()
+	cache := filepath.Join(dir, "cache")
+	if err := os.WriteFile(filepath.Join(dir, "a.html"), []byte("((#x))((y))((/x))"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	options := &Options{CacheDir: cache}
+	parse := func() Node {
+		tmpl, err := ParseFiles(options, dir, "a.html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, _ := tmpl.nodes.Get("a.html")
+		return n
+	}
+
+	n1 := parse()
+
+	entries, _ := filepath.Glob(filepath.Join(cache, "*.tree"))
+	if len(entries) != 1 {
+		t.Fatalf("got %d cache entries, expected 1", len(entries))
+	}
+
+	if n2 := parse(); !reflect.DeepEqual(n1, n2) {
+		t.Error("cached tree differs")
+	}
+
+	// A corrupt entry is replaced.
+	if err := os.WriteFile(entries[0], []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if n3 := parse(); !reflect.DeepEqual(n1, n3) {
+		t.Error("tree differs after corrupt cache entry")
+	}
+	if b, _ := os.ReadFile(entries[0]); string(b) == "garbage" {
+		t.Error("corrupt cache entry was not replaced")
+	}
+}
+
+func BenchmarkUnmarshalTree(b *testing.B) {
+	n, _ := Parse("benchmark", "", "", benchmarkParseTmpl)
+	data, _ := MarshalTree(n)
+
+	for i := 0; i < b.N; i++ {
+		if _, err := UnmarshalTree(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
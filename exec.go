@@ -0,0 +1,707 @@
+package template
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// state holds the state of a single execution of a template.
+type state struct {
+	t         *Template
+	nodes     NodeStorage // Storage, or a snapshot of it, to get templates from.
+	wr        io.Writer
+	name      string                     // Name of the template that is executed.
+	stack     []reflect.Value            // Context stack; innermost context last.
+	params    []map[string]reflect.Value // Parameters of partials, by context.
+	loops     []loop                     // Iterating sections; innermost last.
+	locals    []local                    // Names bound by let tags; innermost last.
+	overrides []map[string]block
+}
+
+// local is a name that is bound by a let tag. It's found before
+// anything in the context stack, until the end of the list of nodes
+// that holds the let tag.
+type local struct {
+	name  string
+	value reflect.Value
+}
+
+// loop is the state of an iterating section, which
+// is available as @index, @key, @first, @last and @length.
+type loop struct {
+	key    reflect.Value
+	index  int
+	length int
+}
+
+// block holds the nodes of a define tag that overrides a block
+// in an inherited template.
+type block struct {
+	name  string // Name of the template that contains the nodes.
+	nodes []Node
+}
+
+var (
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+	zero      reflect.Value
+)
+
+func (s *state) errorf(node Node, format string, args ...interface{}) error {
+	return fmt.Errorf("template: %s:@%d: %s", s.name, node.Position(), fmt.Sprintf(format, args...))
+}
+
+func (s *state) push(v reflect.Value) {
+	s.pushParams(v, nil)
+}
+
+// pushParams pushes the context v of a partial with its parameters,
+// which are found before anything in v.
+func (s *state) pushParams(v reflect.Value, params map[string]reflect.Value) {
+	s.stack = append(s.stack, v)
+	s.params = append(s.params, params)
+}
+
+func (s *state) pop() {
+	s.stack = s.stack[:len(s.stack)-1]
+	s.params = s.params[:len(s.params)-1]
+}
+
+func (s *state) walk(node Node) error {
+	switch n := node.(type) {
+	case *listNode:
+		return s.walkList(n.Children())
+	case *textNode:
+		if w, ok := s.wr.(*indentWriter); ok {
+			return w.writeText(n.Text)
+		}
+		_, err := io.WriteString(s.wr, n.Text)
+		return err
+	case *commentNode:
+		return nil
+	case *variableNode:
+		v, err := s.evalExpression(n.Head, n.Tail)
+		if err != nil {
+			return err
+		}
+		return s.print(v, n.Escape)
+	case *sectionNode:
+		return s.walkSection(n)
+	case *letNode:
+		v, err := s.evalExpression(n.Head, n.Tail)
+		if err != nil {
+			return err
+		}
+		s.locals = append(s.locals, local{n.Name(), v})
+		return nil
+	case *partialNode:
+		return s.walkPartial(n)
+	case *inheritNode:
+		overrides := make(map[string]block)
+		for _, c := range n.Children() {
+			if d, ok := c.(*defineNode); ok {
+				overrides[d.Name()] = block{s.name, d.Children()}
+			}
+		}
+		// Blocks of the inheriting template take precedence over
+		// the blocks of templates further up the chain.
+		return s.walkTemplate(n, n.Name(), append(s.overrides[:len(s.overrides):len(s.overrides)], overrides))
+	case *defineNode:
+		for _, o := range s.overrides {
+			if b, ok := o[n.Name()]; ok {
+				prevName := s.name
+				s.name = b.name
+				err := s.walkList(b.nodes)
+				s.name = prevName
+				return err
+			}
+		}
+		return s.walkList(n.Children())
+	}
+
+	return s.errorf(node, "unknown node: %s", node.Type())
+}
+
+// walkList executes nodes. Names that are bound by let tags in nodes
+// are only available until the end of nodes.
+func (s *state) walkList(nodes []Node) (err error) {
+	locals := len(s.locals)
+	for _, n := range nodes {
+		if err = s.walk(n); err != nil {
+			break
+		}
+	}
+	s.locals = s.locals[:locals]
+
+	return err
+}
+
+// walkTemplate executes the template name, which is referenced by
+// node, in the current context.
+func (s *state) walkTemplate(node Node, name string, overrides []map[string]block) error {
+	name, err := resolveName(s.name, name)
+	if err != nil {
+		return s.errorf(node, "%v", err)
+	}
+
+	tmpl, err := getNode(s.nodes, name)
+	if err != nil {
+		return err
+	}
+
+	// Names bound by let tags are not available in other templates.
+	prevName, prevOverrides, prevLocals := s.name, s.overrides, s.locals
+	s.name, s.overrides, s.locals = name, overrides, nil
+	err = s.walk(tmpl)
+	s.name, s.overrides, s.locals = prevName, prevOverrides, prevLocals
+
+	return err
+}
+
+// walkPartial executes a partial. An optional partial that isn't
+// available renders nothing and the lines of an indented partial
+// are indented. A dynamic partial whose name is missing or empty is
+// a template that isn't available.
+func (s *state) walkPartial(n *partialNode) error {
+	name := n.Name()
+	if n.Dynamic != nil {
+		var err error
+		if name, err = s.partialName(n); err != nil {
+			return err
+		}
+		if name == "" {
+			if n.Optional {
+				return nil
+			}
+			return s.errorf(n, "template not available: *%s is empty", n.Dynamic.Name())
+		}
+	}
+
+	if n.Optional {
+		name, err := resolveName(s.name, name)
+		if err != nil {
+			return s.errorf(n, "%v", err)
+		}
+		if _, ok := s.nodes.Get(name); !ok {
+			return nil
+		}
+	}
+
+	if n.Context != nil || len(n.Params) > 0 {
+		ctx, params, err := s.partialArgs(n)
+		if err != nil {
+			return err
+		}
+		if n.Context != nil {
+			s.pushParams(ctx, params)
+			defer s.pop()
+		} else {
+			// The parameters are added to the current context, so
+			// that paths like ../x find the same context as without.
+			top := len(s.params) - 1
+			prev := s.params[top]
+			s.params[top] = mergeParams(prev, params)
+			defer func() { s.params[top] = prev }()
+		}
+	}
+
+	if n.Indent == "" {
+		return s.walkTemplate(n, name, s.overrides)
+	}
+
+	prev := s.wr
+	err := indent(prev, n.Indent, func(w io.Writer) error {
+		s.wr = w
+		return s.walkTemplate(n, name, s.overrides)
+	})
+	s.wr = prev
+
+	return err
+}
+
+// partialArgs evaluates the context argument and the parameters of a
+// partial. Without a context argument, the context is the current one
+// and the parameters are added to it.
+func (s *state) partialArgs(n *partialNode) (reflect.Value, map[string]reflect.Value, error) {
+	ctx := s.stack[len(s.stack)-1]
+	if n.Context != nil {
+		var err error
+		if ctx, err = s.evalArg(n.Context); err != nil {
+			return zero, nil, err
+		}
+	}
+
+	var params map[string]reflect.Value
+	if len(n.Params) > 0 {
+		params = make(map[string]reflect.Value, len(n.Params))
+	}
+	for _, p := range n.Params {
+		v, err := s.evalArg(p.Value)
+		if err != nil {
+			return zero, nil, err
+		}
+		params[p.Key] = v
+	}
+
+	return ctx, params, nil
+}
+
+// mergeParams returns the parameters of prev and params together.
+// Those in params shadow those in prev.
+func mergeParams[V any](prev, params map[string]V) map[string]V {
+	m := make(map[string]V, len(prev)+len(params))
+	for k, v := range prev {
+		m[k] = v
+	}
+	for k, v := range params {
+		m[k] = v
+	}
+	return m
+}
+
+// partialName returns the name of the template of a dynamic partial,
+// which is the value of its path, or "" if the value is missing.
+func (s *state) partialName(n *partialNode) (string, error) {
+	v, err := s.evalIdentifier(n.Dynamic, nil)
+	if err != nil || !v.IsValid() {
+		return "", err
+	}
+
+	return fmt.Sprint(v.Interface()), nil
+}
+
+// walkSection executes the children of a section. A list or array is
+// iterated and each element is pushed on the context stack. A map is
+// iterated in the order of its keys, which are available as @key,
+// unless it's a Mustache section. Any other value is pushed once. A
+// block helper decides for itself.
+func (s *state) walkSection(n *sectionNode) error {
+	if fn, ok := s.t.helper(n.Head); ok {
+		return s.walkHelper(n, fn)
+	}
+
+	v, err := s.evalExpression(n.Head, n.Tail)
+	if err != nil {
+		return err
+	}
+
+	if truth := isTrue(v); n.Inverted || !truth {
+		if n.Inverted && !truth {
+			return s.walkList(n.Children())
+		}
+		return s.walkList(n.elseChildren())
+	}
+
+	v = indirect(v)
+
+	switch {
+	case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			l := loop{reflect.ValueOf(i), i, v.Len()}
+			if err := s.walkItem(n.Children(), v.Index(i), l); err != nil {
+				return err
+			}
+		}
+		return nil
+	case v.Kind() == reflect.Map && !n.PushMap:
+		keys := sortedKeys(v)
+		for i, k := range keys {
+			l := loop{k, i, len(keys)}
+			if err := s.walkItem(n.Children(), v.MapIndex(k), l); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	s.push(v)
+	err = s.walkList(n.Children())
+	s.pop()
+
+	return err
+}
+
+// sortedKeys returns the keys of the map m in order. Numbers and
+// strings are compared by value and other keys by their formatting.
+func sortedKeys(m reflect.Value) []reflect.Value {
+	keys := m.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		if c, err := compare(keys[i], keys[j]); err == nil {
+			return c < 0
+		}
+		return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+	})
+	return keys
+}
+
+// walkItem executes nodes for an element of an iterating section.
+func (s *state) walkItem(nodes []Node, v reflect.Value, l loop) error {
+	s.push(v)
+	s.loops = append(s.loops, l)
+	err := s.walkList(nodes)
+	s.loops = s.loops[:len(s.loops)-1]
+	s.pop()
+
+	return err
+}
+
+// print writes v, HTML-escaped if escape is true.
+func (s *state) print(v reflect.Value, escape bool) error {
+	v = indirect(v)
+	if !v.IsValid() {
+		return nil
+	}
+
+	if escape {
+		_, err := io.WriteString(s.wr, EscapeHTML(fmt.Sprint(v.Interface())))
+		return err
+	}
+
+	_, err := fmt.Fprint(s.wr, v.Interface())
+	return err
+}
+
+// evalExpression evaluates an expression. If the head is a function
+// it is called with the tail as arguments.
+func (s *state) evalExpression(head Node, tail []Node) (reflect.Value, error) {
+	id, ok := head.(*identifierNode)
+	if !ok {
+		return s.evalArg(head)
+	}
+
+	args := make([]reflect.Value, len(tail))
+	for i, n := range tail {
+		v, err := s.evalArg(n)
+		if err != nil {
+			return zero, err
+		}
+		args[i] = v
+	}
+
+	return s.evalIdentifier(id, args)
+}
+
+func (s *state) evalArg(node Node) (reflect.Value, error) {
+	switch n := node.(type) {
+	case *identifierNode:
+		return s.evalIdentifier(n, nil)
+	case *stringNode:
+		return reflect.ValueOf(n.Text), nil
+	case *numberNode:
+		v, err := parseNumber(n.Text)
+		if err != nil {
+			return zero, s.errorf(n, "%v", err)
+		}
+		return reflect.ValueOf(v), nil
+	case *boolNode:
+		return reflect.ValueOf(n.True), nil
+	case *nilNode:
+		return zero, nil
+	case *sliceNode:
+		items := make([]interface{}, len(n.Items))
+		for i, item := range n.Items {
+			v, err := s.evalArg(item)
+			if err != nil {
+				return zero, err
+			}
+			items[i] = valueInterface(v)
+		}
+		return reflect.ValueOf(items), nil
+	case *mapNode:
+		m := make(map[string]interface{}, len(n.Keys))
+		for i, key := range n.Keys {
+			v, err := s.evalArg(n.Values[i])
+			if err != nil {
+				return zero, err
+			}
+			m[key] = valueInterface(v)
+		}
+		return reflect.ValueOf(m), nil
+	case *binaryNode:
+		return s.evalBinary(n)
+	case *unaryNode:
+		return s.evalUnary(n)
+	case *callNode:
+		return s.evalExpression(n.Func, n.Args)
+	}
+
+	return zero, s.errorf(node, "unexpected argument: %s", node.Type())
+}
+
+// evalIdentifier resolves the path of an identifier. The first element is
+// looked up in the context stack, starting with the innermost context.
+// A name that cannot be found resolves to the invalid Value. Only the
+// last element of the path receives args.
+func (s *state) evalIdentifier(id *identifierNode, args []reflect.Value) (reflect.Value, error) {
+	var v reflect.Value
+	path := id.path[1:]
+
+	if i, rest, ok := id.anchor(len(s.stack)); ok {
+		if i >= 0 {
+			v = s.stack[i]
+		}
+		path = rest
+		if i >= 0 && len(rest) > 0 {
+			if p, ok := s.params[i][rest[0]]; ok {
+				v, path = p, rest[1:]
+			}
+		}
+	} else if strings.HasPrefix(id.path[0], "@") {
+		var err error
+		if v, err = s.variable(id); err != nil {
+			return zero, err
+		}
+	} else if l, ok := s.local(id.path[0]); ok {
+		v = l
+	} else {
+		for i := len(s.stack) - 1; i >= 0; i-- {
+			// A parameter shadows the data, even if its value is missing.
+			if p, ok := s.params[i][id.path[0]]; ok {
+				v = p
+				break
+			}
+			if v = lookup(s.stack[i], id.path[0]); v.IsValid() {
+				break
+			}
+		}
+	}
+
+	for _, name := range path {
+		if !v.IsValid() {
+			break
+		}
+		v = lookup(call(v, nil), name)
+	}
+
+	if !v.IsValid() {
+		return zero, nil
+	}
+
+	v = call(v, args)
+	if v.Kind() == reflect.Func {
+		return zero, s.errorf(id, "cannot call %s with %d arguments", id.Name(), len(args))
+	}
+	if err, ok := v.Interface().(error); ok && v.Type() == errorType {
+		return zero, s.errorf(id, "%s: %v", id.Name(), err)
+	}
+
+	return v, nil
+}
+
+// local returns the value of the innermost name that is bound by a let
+// tag, if any.
+func (s *state) local(name string) (reflect.Value, bool) {
+	for i := len(s.locals) - 1; i >= 0; i-- {
+		if s.locals[i].name == name {
+			return s.locals[i].value, true
+		}
+	}
+	return zero, false
+}
+
+// variable returns the value of a variable like @index, which belongs
+// to the innermost iterating section. Outside of one it's missing.
+func (s *state) variable(id *identifierNode) (reflect.Value, error) {
+	name := id.path[0]
+	if !isVariable(name) {
+		return zero, s.errorf(id, "unknown variable %s", name)
+	}
+	if len(s.loops) == 0 {
+		return zero, nil
+	}
+
+	l := s.loops[len(s.loops)-1]
+
+	switch name {
+	case "@index":
+		return reflect.ValueOf(l.index), nil
+	case "@key":
+		return l.key, nil
+	case "@first":
+		return reflect.ValueOf(l.index == 0), nil
+	case "@last":
+		return reflect.ValueOf(l.index == l.length-1), nil
+	}
+
+	return reflect.ValueOf(l.length), nil
+}
+
+// isVariable reports whether name is a known variable.
+func isVariable(name string) bool {
+	switch name {
+	case "@index", "@key", "@first", "@last", "@length":
+		return true
+	}
+	return false
+}
+
+// lookup returns the field, method or map value called name of v,
+// or the invalid Value if v has no such thing.
+func lookup(v reflect.Value, name string) reflect.Value {
+	if !v.IsValid() {
+		return zero
+	}
+	name = segmentKey(name)
+
+	if m := v.MethodByName(name); m.IsValid() {
+		return m
+	}
+
+	v = indirect(v)
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if f, ok := v.Type().FieldByName(name); ok && f.IsExported() {
+			return v.FieldByIndex(f.Index)
+		}
+		if _, ok := reflect.PointerTo(v.Type()).MethodByName(name); ok {
+			if !v.CanAddr() {
+				p := reflect.New(v.Type())
+				p.Elem().Set(v)
+				v = p.Elem()
+			}
+			return v.Addr().MethodByName(name)
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() == reflect.String {
+			return v.MapIndex(reflect.ValueOf(name).Convert(v.Type().Key()))
+		}
+	case reflect.Slice, reflect.Array:
+		if i, ok := sliceIndex(name, v.Len()); ok {
+			return v.Index(i)
+		}
+	}
+
+	return zero
+}
+
+// segmentKey returns the name or key that an element of a path refers
+// to. Indexes like [0] and ["Content-Type"] are written with brackets.
+func segmentKey(name string) string {
+	if !strings.HasPrefix(name, "[") {
+		return name
+	}
+
+	name = name[1 : len(name)-1]
+	if s, err := strconv.Unquote(name); err == nil {
+		return s
+	}
+
+	return name
+}
+
+// sliceIndex returns the index in a list of length n that name refers
+// to. Negative indexes count from the end.
+func sliceIndex(name string, n int) (int, bool) {
+	i, err := strconv.Atoi(name)
+	if err != nil {
+		return 0, false
+	}
+	if i < 0 {
+		i += n
+	}
+
+	return i, i >= 0 && i < n
+}
+
+// call calls v with args if v is a function. A function may return a
+// single value or a value and an error. The error is returned as value.
+func call(v reflect.Value, args []reflect.Value) reflect.Value {
+	if v.Kind() != reflect.Func || v.IsNil() {
+		return v
+	}
+
+	typ := v.Type()
+	if !typ.IsVariadic() && typ.NumIn() != len(args) || typ.IsVariadic() && len(args) < typ.NumIn()-1 {
+		return v
+	}
+	if typ.NumOut() == 0 || typ.NumOut() > 2 || typ.NumOut() == 2 && typ.Out(1) != errorType {
+		return v
+	}
+
+	in := make([]reflect.Value, len(args))
+	for i, arg := range args {
+		var t reflect.Type
+		if typ.IsVariadic() && i >= typ.NumIn()-1 {
+			t = typ.In(typ.NumIn() - 1).Elem()
+		} else {
+			t = typ.In(i)
+		}
+
+		switch {
+		case !arg.IsValid():
+			in[i] = reflect.Zero(t)
+		case arg.Type().AssignableTo(t):
+			in[i] = arg
+		case arg.Type().ConvertibleTo(t):
+			in[i] = arg.Convert(t)
+		default:
+			return v
+		}
+	}
+
+	out := v.Call(in)
+	if len(out) == 2 && !out[1].IsNil() {
+		return out[1]
+	}
+
+	return out[0]
+}
+
+// indirect dereferences pointers and interfaces.
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return zero
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// valueInterface returns the value of v, or nil if v is missing.
+func valueInterface(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	return v.Interface()
+}
+
+// isTrue reports whether v is a non-zero value,
+// or a non-empty list, map or string.
+func isTrue(v reflect.Value) bool {
+	v = indirect(v)
+	if !v.IsValid() {
+		return false
+	}
+
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() > 0
+	case reflect.Func, reflect.Chan:
+		return !v.IsNil()
+	case reflect.Struct:
+		return true
+	}
+
+	return !v.IsZero()
+}
+
+// parseNumber converts the text of a numberNode to an int64,
+// float64 or complex128.
+func parseNumber(text string) (interface{}, error) {
+	if i, err := strconv.ParseInt(text, 0, 64); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(text, 64); err == nil {
+		return f, nil
+	}
+	if c, err := strconv.ParseComplex(text, 128); err == nil {
+		return c, nil
+	}
+
+	return nil, fmt.Errorf("illegal number syntax: %q", text)
+}
@@ -0,0 +1,198 @@
+package template
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// parseTemplates parses sources, keyed by name, into a Template.
+func parseTemplates(t testing.TB, sources map[string]string) *Template {
+	m := make(map[string]Node)
+	for name, src := range sources {
+		n, err := Parse(name, "", "", src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m[name] = n
+	}
+
+	return New(NewNodeMap(m))
+}
+
+type execUser struct {
+	Name  string
+	Admin bool
+	Tags  []string
+	Meta  map[string]int
+}
+
+func (u execUser) Greet(greeting string) string {
+	return greeting + ", " + u.Name
+}
+
+func (u *execUser) Initial() string {
+	return u.Name[:1]
+}
+
+func (u execUser) OneOf(names []interface{}) bool {
+	for _, n := range names {
+		if n == u.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func (u execUser) Fail() (string, error) {
+	return "", errors.New("failed")
+}
+
+type execWidget struct {
+	Template string
+	Title    string
+}
+
+type execData struct {
+	Title   string
+	User    *execUser
+	Users   []execUser
+	Count   int
+	Headers map[string]string
+	Widgets []execWidget
+}
+
+var execTests = []struct {
+	name   string
+	input  string
+	result string
+	err    string
+}{
+	{"text", "hello", "hello", ""},
+	{"comment", "a((! b ))c", "ac", ""},
+	{"variable", "((Title))", "Page", ""},
+	{"field-path", "((User.Name))", "Ann", ""},
+	{"missing", "[((Nope))][((User.Nope))]", "[][]", ""},
+	{"string", `(("x"))((1.5))`, "x1.5", ""},
+	{"string-escapes", "((\"a\\tb\\u00e9\\\"\")) ((`x\\n\ny`))", "a\tb\u00e9\" x\\n\ny", ""},
+	{"method-args", `((User.Greet "Hi"))`, "Hi, Ann", ""},
+	{"pointer-method", `((#Users))((Initial))((/Users))`, "AB", ""},
+	{"method-error", `((User.Fail))`, "", "failed"},
+	{"wrong-args", `((User.Greet))`, "", "cannot call User.Greet with 0 arguments"},
+	{"section-list", "((#Users))<((Name))>((/Users))", "<Ann><Bob>", ""},
+	{"section-struct", "((#User))((Name)) ((Title))((/User))", "Ann Page", ""},
+	{"section-map", "((#User.Meta))((@key))=((.))((/User.Meta))", "age=42", ""},
+	{"section-map-keys", "((#Headers))((@index)):((@key))=((.));((/Headers))", "0:Content-Type=text/html;1:created-at=today;", ""},
+	{"section-bool", "((#User.Admin))admin((/User.Admin))", "admin", ""},
+	{"section-false", "((#Count))x((/Count))", "", ""},
+	{"loop-variables", "((#Users))((@index))((@key))((@first))((@last))((@length)) ((/Users))", "00truefalse2 11falsetrue2 ", ""},
+	{"loop-variable-section", "((#Users))((^@first)), ((/@first))((Name))((/Users))", "Ann, Bob", ""},
+	{"loop-variable-nested", "((#Users))((#User))((@index))((/User))((/Users))[((@index))]", "01[]", ""},
+	{"unknown-variable", "((@nope))", "", "unknown variable @nope"},
+	{"parent", "((#Users))((Name)) ((../Title))|((/Users))", "Ann Page|Bob Page|", ""},
+	{"parent-section", "((#Users))((#../User))((../Name))((/../User))((#..))((Title))((/..))((/Users))", "AnnPageBobPage", ""},
+	{"parent-parent", "((#Users))((#User))((../../Title))((/User))((/Users))", "PagePage", ""},
+	{"above-root", "[((../Title))][((..))]", "[][]", ""},
+	{"root", "((#User))((@root.Title)) ((@root.User.Name))((/User))", "Page Ann", ""},
+	{"index", "((Users.0.Name)) ((Users[1].Name)) ((Users[-1].Name))[((Users[2].Name))]", "Ann Bob Bob[]", ""},
+	{"index-section", "((#Users[-2]))((Name))((/Users[-2]))", "Ann", ""},
+	{"quoted-key", `((Headers["Content-Type"])) ((User.Meta["age"]))((Headers["nope"]))`, "text/html 42", ""},
+	{"inverted", "((^Count))none((/Count))((^Users))x((/Users))", "none", ""},
+	{"compare", `((Count == 0)) ((Count != 0)) ((User.Meta.age > 40)) ((Title < "Q")) ((1 <= 1.5)) ((Count >= 1))`, "true false true true true false", ""},
+	{"logic", "((#Count > 0 || User.Admin && !Nope))yes((/))((^Title && Count))no((/))", "yesno", ""},
+	{"negation", "(((!Nope) && User.Admin)) ((#!Nope))yes((/))((! comment))((!note))", "true yes", ""},
+	{"minus-spacing", "((Count - 1)) ((Count-1)) ((-1 * -Count))", "-1 -1 0", ""},
+	{"impossible-path", "((let x = Count))[((x.foo))]((let u = User))[((u.Nope.x))][((User.Meta.age.x))]", "[][][]", ""},
+	{"paren-args", `((User.Greet ("Hi" + "!"))) (([(-1), (Count + 1)])) ((>args (-2) n=(Count - 3)))`, "Hi!, Ann [-1 1] -2 -3", ""},
+	{"arithmetic", `((User.Meta.age + 1)) ((7 / 2)) ((7 % 4)) ((7.0 / 2)) ((-User.Meta.age * 2)) ((Title + "!")) ((Count-1))`, "43 3 3 3.5 -84 Page! -1", ""},
+	{"precedence", "((1 + 2 * 3)) (((1 + 2) * 3)) ((Count == 0 && !(Count || Title)))", "7 9 false", ""},
+	{"default", `((Nope ?? "none")) ((Title ?? "none")) ((User.Nope ?? User.Name))`, "none Page Ann", ""},
+	{"operator-missing", "[((Nope + 1))][((Nope > 1))][((Nope == User.Nope))]", "[][false][true]", ""},
+	{"operator-call", `((User.Greet "Hi" == "Hi, Ann")) ((#(User.Greet "Yo")))((.))((/))`, "true Yo, Ann", ""},
+	{"operator-section", "((#Users))((#@index > 0))((Name))((/))((/Users))", "Bob", ""},
+	{"division-by-zero", "((1 / Count))", "", "division-by-zero:@4: division by zero"},
+	{"compare-types", `((Title < 1))`, "", "cannot compare string and int64"},
+	{"literals", `((true)) ((false)) [((nil))] ((true == !false)) ((nil ?? "x")) (([1, "a", Nope])) (({b: 2, a: Title}))`, "true false [] true x [1 a <nil>] map[a:Page b:2]", ""},
+	{"list-arg", `((User.OneOf ["Bob", Users.0.Name])) ((User.OneOf [])) ((User.OneOf nil))`, "true false false", ""},
+	{"map-context", `((> card {Name: "Cy"} title=Title compact=true)) ((> card [1] title=[]))`, "[Page: Cy compact] [[]: ]", ""},
+	{"else", "((#User))Hi ((Name))((else))log in((/User)) ((#Nope))Hi((else))log in((/Nope)) ((#Count))x((^))none((/Count))", "Hi Ann log in none", ""},
+	{"else-list", "((#Nope))x((else))((Title))((/Nope)) ((#User.Tags))t((else))no tags((/User.Tags)) ((#Users))((Name))((else))x((/Users))", "Page no tags AnnBob", ""},
+	{"else-inverted", "((^Users))none((else))((#Users))((Name))((/Users))((/Users))", "AnnBob", ""},
+	{"else-operator", "((#Count > 0))pos((else))zero((/))", "zero", ""},
+	{"else-chained", "((#Nope))a((else #User.Admin))((Title))((else ^Count))zero((else))other((/Nope)) ((#Count))a((else #Nope))b((else))c((/Count))", "Page c", ""},
+	{"let", `((let n = User.Name))((let x = n + "!"))((x)) ((#Users))((let n = Name))((n))((/Users)) ((n))`, "Ann! AnnBob Ann", ""},
+	{"let-scope", "((#User))((let t = Title))((t))((/User))[((t))]((#Nope))((else))((let e = 1))((/Nope))[((e))]", "Page[][]", ""},
+	{"let-shadows", `((let Title = "Mine"))((Title)) ((#User))((Title))((/User))`, "Mine Mine", ""},
+	{"let-call", `((let g = User.Greet "Hi"))((g)) ((let m = Nope))[((m ?? "none"))] ((let u = User))((u.Name)) ((u.Initial))`, "Hi, Ann [none] Ann A", ""},
+	{"let-partial", `((let title = "x"))((title))((> card))`, "x[: ]", ""},
+	{"partial", "((>user))", "[Ann]", ""},
+	{"missing-partial", "((>nope))", "", "template not available: nope"},
+	{"dynamic-partial", "((#Widgets))((> *Template))((/Widgets))", "<chart Sales><note Hi>", ""},
+	{"dynamic-partial-missing", "((> *Title))", "", "template not available: Page"},
+	{"dynamic-partial-empty", "((> *Nope))((> *User.Nope))", "", "dynamic-partial-empty:@0: template not available: *Nope is empty"},
+	{"partial-args", `((> card User title="Sale" compact=1))`, "[Sale: Ann compact]", ""},
+	{"partial-params", "((#User))((> card title=Title))((/User))((#Users))((> card title=@index))((/Users))", "[Page: Ann][0: Ann][1: Bob]", ""},
+	{"partial-params-parent", "((#Users))((> up))((> up n=@index))((/Users))", "[Page][Page0][Page][Page1]", ""},
+	{"partial-param-shadows", `((#User))((> card title="x" Name=Nope))((/User))`, "[x: ]", ""},
+	{"partial-context", `((> card Users.1))((> card "s" title=Users.0.Name))`, "[: Bob][Ann: ]", ""},
+	{"inherit", "((<layout))(($body))Body((/body))((/layout))", "<title>Page</title>Body", ""},
+	{"inherit-chain", "((<page))(($title))Mine((/title))((/page))", "<title>Mine</title>Page body", ""},
+}
+
+var execTemplates = map[string]string{
+	"user":   "[((User.Name))]",
+	"layout": "<title>(($title))((Title))((/title))</title>(($body))((/body))",
+	"page":   "((<layout))(($body))Page body((/body))((/layout))",
+	"chart":  "<chart ((Title))>",
+	"card":   "[((title)): ((Name))((#compact)) compact((/compact))]",
+	"note":   "<note ((Title))>",
+	"args":   "((.)) ((n))",
+	"up":     "[((../Title))((n))]",
+}
+
+var execTestData = &execData{
+	Title:   "Page",
+	User:    &execUser{Name: "Ann", Admin: true, Meta: map[string]int{"age": 42}},
+	Users:   []execUser{{Name: "Ann"}, {Name: "Bob"}},
+	Headers: map[string]string{"Content-Type": "text/html", "created-at": "today"},
+	Widgets: []execWidget{{"chart", "Sales"}, {"note", "Hi"}},
+}
+
+func TestExecute(t *testing.T) {
+	for _, test := range execTests {
+		sources := map[string]string{test.name: test.input}
+		for k, v := range execTemplates {
+			sources[k] = v
+		}
+
+		var buf bytes.Buffer
+		err := parseTemplates(t, sources).Execute(&buf, test.name, execTestData)
+
+		switch {
+		case err != nil && test.err == "":
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		case err != nil && !strings.Contains(err.Error(), test.err):
+			t.Errorf("%s: got error\n\t%v\nexpected\n\t%v", test.name, err, test.err)
+		case err == nil && test.err != "":
+			t.Errorf("%s: expected error; got none", test.name)
+		case buf.String() != test.result:
+			t.Errorf("%s: got\n\t%q\nexpected\n\t%q", test.name, buf.String(), test.result)
+		}
+	}
+}
+
+func TestExecuteKebabCase(t *testing.T) {
+	n, err := ParseOptions("kebab", &Options{KebabCase: true}, `((Headers.created-at)) ((Headers.Content-Type))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := New(NewNodeMap(map[string]Node{"kebab": n})).Execute(&buf, "kebab", execTestData); err != nil {
+		t.Fatal(err)
+	}
+	if got, expected := buf.String(), "today text/html"; got != expected {
+		t.Errorf("got %q, expected %q", got, expected)
+	}
+}
@@ -0,0 +1,1617 @@
+package template
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// GenerateOptions configures Template.Generate.
+type GenerateOptions struct {
+	Package string                  // Name of the generated package.
+	PkgPath string                  // Import path of the generated package. Its types are not qualified.
+	Types   map[string]reflect.Type // Templates to generate, with the type of their data.
+}
+
+// Generate writes the Go source of a package with a render function for
+// each template in options.Types. The function for the template "users/list"
+// with data of type *Page is:
+//
+//	func RenderUsersList(w io.Writer, data *Page) error
+//
+// Text is written from byte slices, partials are called as functions and
+// inherited templates are resolved while generating. Identifiers are
+// resolved with the types of the data, which means that the generated
+// code accesses fields, map keys and methods directly. Only values that
+// are typed as interfaces are resolved with reflection at run time. The
+// output of the generated code is the same as that of Execute.
+func (t *Template) Generate(w io.Writer, options *GenerateOptions) error {
+	g := &generator{
+		t:       t,
+		options: options,
+		imports: make(map[string]string),
+		uses:    make(map[string]bool),
+		texts:   make(map[string]string),
+		funcs:   make(map[string]string),
+		rt:      "template.",
+	}
+	if options.PkgPath == templatePkgPath {
+		g.rt = ""
+	}
+
+	var names []string
+	for name := range options.Types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var public bytes.Buffer
+	exported := make(map[string]string)
+
+	for _, name := range names {
+		typ := options.Types[name]
+		fn := "Render" + exportedName(name)
+		if other, ok := exported[fn]; ok {
+			return fmt.Errorf("template: %s and %s both generate %s", other, name, fn)
+		}
+		exported[fn] = name
+
+		typeName, err := g.typeString(typ)
+		if err != nil {
+			return err
+		}
+
+		impl, err := g.function(name, []genCtx{{"c0", staticType(typ), nil}}, nil, false)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(&public, "\n// %s renders the template %q.\n", fn, name)
+		fmt.Fprintf(&public, "func %s(w io.Writer, data %s) error {\n\treturn %s(w, data)\n}\n", fn, typeName, impl)
+	}
+
+	// Functions for partials are added to the queue while generating.
+	var funcs bytes.Buffer
+	for len(g.queue) > 0 {
+		f := g.queue[0]
+		g.queue = g.queue[1:]
+
+		if err := g.generateFunc(&funcs, f); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by tmplgen. DO NOT EDIT.\n\npackage %s\n\nimport (\n", options.Package)
+
+	paths := []string{"io"}
+	for p := range g.uses {
+		paths = append(paths, p)
+	}
+	for p := range g.imports {
+		if !g.uses[p] {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		if name, ok := g.imports[p]; ok && name != path.Base(p) {
+			fmt.Fprintf(&buf, "\t%s %q\n", name, p)
+		} else {
+			fmt.Fprintf(&buf, "\t%q\n", p)
+		}
+	}
+
+	buf.WriteString(")\n")
+	buf.Write(public.Bytes())
+	buf.Write(funcs.Bytes())
+
+	if len(g.textOrder) > 0 {
+		buf.WriteString("\nvar (\n")
+		for _, text := range g.textOrder {
+			fmt.Fprintf(&buf, "\t%s = []byte(%s)\n", g.texts[text], strconv.Quote(text))
+		}
+		buf.WriteString(")\n")
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("template: cannot format generated code: %v", err)
+	}
+
+	_, err = w.Write(src)
+	return err
+}
+
+// templatePkgPath is the import path of this package, which
+// generated code uses for values that are typed as interfaces.
+const templatePkgPath = "github.com/FSX/template"
+
+// exportedName turns a template name into an exported Go identifier,
+// e.g. "users/list.html" into "UsersListHTML".
+func exportedName(name string) string {
+	var b strings.Builder
+	upper := true
+
+	for _, r := range name {
+		switch {
+		case r == '_' || !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			upper = true
+		case upper:
+			b.WriteRune(unicode.ToUpper(r))
+			upper = false
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// staticType returns typ, or nil if values of the type
+// can only be resolved at run time.
+func staticType(typ reflect.Type) reflect.Type {
+	if typ == nil || typ.Kind() == reflect.Interface {
+		return nil
+	}
+	return typ
+}
+
+// genCtx is an element of the context stack while generating.
+type genCtx struct {
+	expr   string       // Go expression of the context.
+	typ    reflect.Type // Static type, or nil if it's an interface{}.
+	params []genParam   // Parameters of a partial.
+}
+
+// genParam is a parameter of a partial while generating. A value that
+// may be missing is an interface{} that is nil if it's missing.
+type genParam struct {
+	key string
+	v   genVal
+}
+
+// param returns the parameter key of the context.
+func (c genCtx) param(key string) (genVal, bool) {
+	for _, p := range c.params {
+		if p.key == key {
+			return p.v, true
+		}
+	}
+	return genVal{}, false
+}
+
+// genBlocks is a set of overriding blocks with a key
+// that identifies it in function keys.
+type genBlocks struct {
+	key    string
+	blocks map[string]block
+}
+
+// genFunc is a function that renders a template in a
+// particular context.
+type genFunc struct {
+	name      string
+	tmpl      string
+	node      Node
+	stack     []genCtx
+	overrides []genBlocks
+	indented  bool // Called in an indented Mustache partial.
+}
+
+type generator struct {
+	t         *Template
+	options   *GenerateOptions
+	imports   map[string]string // Import path to package name.
+	uses      map[string]bool   // Import paths used by generated code.
+	texts     map[string]string // Text to the name of its variable.
+	textOrder []string
+	funcs     map[string]string // Function key to function name.
+	queue     []*genFunc
+	rt        string // Qualifier of the run time functions.
+}
+
+// use records that the generated code uses the standard package
+// path and returns its name.
+func (g *generator) use(path string) string {
+	g.uses[path] = true
+	return path
+}
+
+// runtime returns the qualifier of the run time functions in this
+// package and records that the generated code uses them.
+func (g *generator) runtime() string {
+	if g.rt != "" {
+		g.uses[templatePkgPath] = true
+	}
+	return g.rt
+}
+
+// function returns the name of the function that renders the template
+// name with the types of stack and the overrides, in an indented partial
+// if indented is true. The function is generated later if it doesn't
+// exist yet.
+func (g *generator) function(name string, stack []genCtx, overrides []genBlocks, indented bool) (string, error) {
+	node, err := getNode(g.t.nodes, name)
+	if err != nil {
+		return "", err
+	}
+
+	key := name
+	for _, c := range stack {
+		key += "|" + fmt.Sprint(c.typ)
+		for _, p := range c.params {
+			key += "," + p.key + "=" + fmt.Sprint(p.v.typ)
+		}
+	}
+	for _, o := range overrides {
+		key += "|" + o.key
+	}
+	if indented {
+		key += "|indented"
+	}
+
+	if fn, ok := g.funcs[key]; ok {
+		return fn, nil
+	}
+
+	fn := "render" + strconv.Itoa(len(g.funcs))
+	g.funcs[key] = fn
+
+	params := make([]genCtx, len(stack))
+	for i, c := range stack {
+		params[i] = genCtx{"c" + strconv.Itoa(i), c.typ, nil}
+		for j, p := range c.params {
+			v := genVal{"p" + strconv.Itoa(i) + "_" + strconv.Itoa(j), p.v.typ, true}
+			params[i].params = append(params[i].params, genParam{p.key, v})
+		}
+	}
+
+	g.queue = append(g.queue, &genFunc{fn, name, node, params, overrides, indented})
+
+	return fn, nil
+}
+
+func (g *generator) generateFunc(w *bytes.Buffer, f *genFunc) error {
+	s := &genState{
+		g:         g,
+		name:      f.tmpl,
+		stack:     f.stack,
+		overrides: f.overrides,
+		indented:  f.indented,
+		indent:    1,
+	}
+
+	if err := s.walk(f.node); err != nil {
+		return err
+	}
+
+	var params []string
+	for _, c := range f.stack {
+		vals := []genVal{{c.expr, c.typ, true}}
+		for _, p := range c.params {
+			vals = append(vals, p.v)
+		}
+
+		for _, v := range vals {
+			typ := "interface{}"
+			if v.typ != nil {
+				var err error
+				if typ, err = g.typeString(v.typ); err != nil {
+					return err
+				}
+			}
+			params = append(params, v.expr+" "+typ)
+		}
+	}
+
+	fmt.Fprintf(w, "\n// %s renders %q.\nfunc %s(w io.Writer, %s) error {\n", f.name, f.tmpl, f.name, strings.Join(params, ", "))
+	w.Write(s.buf.Bytes())
+	w.WriteString("\treturn nil\n}\n")
+
+	return nil
+}
+
+// text returns the name of the variable that holds text.
+func (g *generator) text(text string) string {
+	if name, ok := g.texts[text]; ok {
+		return name
+	}
+
+	name := "text" + strconv.Itoa(len(g.texts))
+	g.texts[text] = name
+	g.textOrder = append(g.textOrder, text)
+
+	return name
+}
+
+// typeString returns the Go source of a type and
+// imports the packages it needs.
+func (g *generator) typeString(typ reflect.Type) (string, error) {
+	if typ.Name() != "" {
+		switch {
+		case typ.PkgPath() == "":
+			return typ.Name(), nil
+		case typ.PkgPath() == g.options.PkgPath:
+			return typ.Name(), nil
+		case !isExported(typ.Name()):
+			return "", fmt.Errorf("template: cannot refer to unexported type %s", typ)
+		}
+		return g.importName(typ.PkgPath()) + "." + typ.Name(), nil
+	}
+
+	switch typ.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		elem, err := g.typeString(typ.Elem())
+		if err != nil {
+			return "", err
+		}
+		switch typ.Kind() {
+		case reflect.Ptr:
+			return "*" + elem, nil
+		case reflect.Slice:
+			return "[]" + elem, nil
+		}
+		return "[" + strconv.Itoa(typ.Len()) + "]" + elem, nil
+	case reflect.Map:
+		key, err := g.typeString(typ.Key())
+		if err != nil {
+			return "", err
+		}
+		elem, err := g.typeString(typ.Elem())
+		if err != nil {
+			return "", err
+		}
+		return "map[" + key + "]" + elem, nil
+	case reflect.Interface:
+		if typ.NumMethod() == 0 {
+			return "interface{}", nil
+		}
+	}
+
+	return "", fmt.Errorf("template: cannot refer to type %s", typ)
+}
+
+func (g *generator) importName(pkgPath string) string {
+	if name, ok := g.imports[pkgPath]; ok {
+		return name
+	}
+
+	base := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, path.Base(pkgPath))
+
+	name := base
+	for i := 2; g.importUsed(name); i++ {
+		name = base + strconv.Itoa(i)
+	}
+
+	g.imports[pkgPath] = name
+	return name
+}
+
+func (g *generator) importUsed(name string) bool {
+	switch name {
+	case "errors", "fmt", "io", "template":
+		return true
+	}
+	for _, n := range g.imports {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func isExported(name string) bool {
+	for _, r := range name {
+		return unicode.IsUpper(r)
+	}
+	return false
+}
+
+// genVal is the result of an expression while generating.
+type genVal struct {
+	expr  string
+	typ   reflect.Type // Static type, or nil if it's an interface{}.
+	valid bool         // False if the expression is known to be missing.
+}
+
+// genState generates the body of a function, like state executes a
+// template. Code that depends on a value that may be missing (e.g. a
+// nil pointer or a missing map key) is wrapped in blocks that check
+// for it.
+type genState struct {
+	g         *generator
+	buf       bytes.Buffer
+	indent    int
+	tmp       int
+	name      string
+	stack     []genCtx
+	overrides []genBlocks
+	loops     []genLoop
+	locals    []genLocal
+	indented  bool
+	depth     int // Depth of inherited templates.
+}
+
+// genLocal is a name that is bound by a let tag, like local.
+type genLocal struct {
+	name string
+	v    genVal
+}
+
+// genLoop is an iterating section while generating.
+type genLoop struct {
+	index   string       // Go expression of @index.
+	length  string       // Go expression of @length.
+	key     string       // Go expression of @key.
+	keyType reflect.Type // Static type of @key, or nil if it's an interface{}.
+	maybe   bool         // The index is -1 if the section doesn't iterate.
+}
+
+func (s *genState) line(format string, args ...interface{}) {
+	s.buf.WriteString(strings.Repeat("\t", s.indent))
+	fmt.Fprintf(&s.buf, format, args...)
+	s.buf.WriteByte('\n')
+}
+
+// open writes a line that opens a block.
+func (s *genState) open(format string, args ...interface{}) {
+	s.line(format+" {", args...)
+	s.indent++
+}
+
+// close closes n blocks.
+func (s *genState) close(n int) {
+	for ; n > 0; n-- {
+		s.indent--
+		s.line("}")
+	}
+}
+
+// check writes a statement that returns the error of a write.
+func (s *genState) check(stmt string) {
+	s.open("if %s; err != nil", stmt)
+	s.line("return err")
+	s.close(1)
+}
+
+func (s *genState) tmpVar(prefix string) string {
+	s.tmp++
+	return prefix + strconv.Itoa(s.tmp)
+}
+
+func (s *genState) errorf(node Node, format string, args ...interface{}) error {
+	return fmt.Errorf("template: %s:@%d: %s", s.name, node.Position(), fmt.Sprintf(format, args...))
+}
+
+// runtimeError writes code that returns the error that
+// Execute returns at this point.
+func (s *genState) runtimeError(node Node, format string, args ...interface{}) {
+	s.line("return %s.New(%q)", s.g.use("errors"), s.errorf(node, format, args...).Error())
+}
+
+func (s *genState) walk(node Node) error {
+	switch n := node.(type) {
+	case *listNode:
+		return s.walkList(n.Children())
+	case *textNode:
+		switch {
+		case n.Text == "":
+		case s.indented:
+			s.check(fmt.Sprintf("err := %sGenText(w, %s)", s.g.runtime(), s.g.text(n.Text)))
+		default:
+			s.check(fmt.Sprintf("_, err := w.Write(%s)", s.g.text(n.Text)))
+		}
+		return nil
+	case *commentNode:
+		return nil
+	case *variableNode:
+		v, closers, err := s.evalExpression(n.Head, n.Tail)
+		if err != nil {
+			return err
+		}
+		s.print(v, n.Escape)
+		s.close(closers)
+		return nil
+	case *sectionNode:
+		return s.walkSection(n)
+	case *letNode:
+		mark, indent := s.buf.Len(), s.indent
+		v, closers, err := s.evalExpression(n.Head, n.Tail)
+		if err != nil {
+			return err
+		}
+		v = s.hold(v, closers, mark, indent)
+		s.line("_ = %s", v.expr)
+		s.locals = append(s.locals, genLocal{n.Name(), v})
+		return nil
+	case *partialNode:
+		if n.Dynamic != nil {
+			return s.errorf(n, "dynamic partial %s is not supported in generated code", n.Name())
+		}
+
+		name, err := resolveName(s.name, n.Name())
+		if err != nil {
+			return s.errorf(n, "%v", err)
+		}
+
+		if _, ok := s.g.t.nodes.Get(name); !ok && n.Optional {
+			return nil
+		}
+
+		stack := s.stack
+		if n.Context != nil || len(n.Params) > 0 {
+			ctx, err := s.partialArgs(n)
+			if err != nil {
+				return err
+			}
+			if n.Context != nil {
+				stack = append(stack[:len(stack):len(stack)], ctx)
+			} else {
+				stack = append(stack[:len(stack)-1:len(stack)-1], ctx)
+			}
+		}
+
+		fn, err := s.g.function(name, stack, s.overrides, s.indented || n.Indent != "")
+		if err != nil {
+			return s.errorf(n, "%v", err)
+		}
+
+		args := []string{"w"}
+		for _, c := range stack {
+			args = append(args, c.expr)
+			for _, p := range c.params {
+				args = append(args, p.v.expr)
+			}
+		}
+
+		if n.Indent == "" {
+			s.check(fmt.Sprintf("err := %s(%s)", fn, strings.Join(args, ", ")))
+			return nil
+		}
+
+		s.open("if err := %sGenIndent(w, %q, func(w io.Writer) error", s.g.runtime(), n.Indent)
+		s.line("return %s(%s)", fn, strings.Join(args, ", "))
+		s.indent--
+		s.line("}); err != nil {")
+		s.indent++
+		s.line("return err")
+		s.close(1)
+		return nil
+	case *inheritNode:
+		name, err := resolveName(s.name, n.Name())
+		if err != nil {
+			return s.errorf(n, "%v", err)
+		}
+
+		parent, err := getNode(s.g.t.nodes, name)
+		if err != nil {
+			return s.errorf(n, "%v", err)
+		}
+		if s.depth > 100 {
+			return s.errorf(n, "inherited templates nested too deep")
+		}
+
+		overrides := genBlocks{key: fmt.Sprintf("%p", n), blocks: make(map[string]block)}
+		for _, c := range n.Children() {
+			if d, ok := c.(*defineNode); ok {
+				overrides.blocks[d.Name()] = block{s.name, d.Children()}
+			}
+		}
+
+		prevName, prevOverrides, prevLocals := s.name, s.overrides, s.locals
+		s.name, s.locals = name, nil
+		s.overrides = append(s.overrides[:len(s.overrides):len(s.overrides)], overrides)
+		s.depth++
+		err = s.walk(parent)
+		s.depth--
+		s.name, s.overrides, s.locals = prevName, prevOverrides, prevLocals
+		return err
+	case *defineNode:
+		for _, o := range s.overrides {
+			if b, ok := o.blocks[n.Name()]; ok {
+				prevName := s.name
+				s.name = b.name
+				err := s.walkList(b.nodes)
+				s.name = prevName
+				return err
+			}
+		}
+		return s.walkList(n.Children())
+	}
+
+	return s.errorf(node, "unknown node: %s", node.Type())
+}
+
+func (s *genState) walkList(nodes []Node) error {
+	locals := len(s.locals)
+	for _, n := range nodes {
+		if err := s.walk(n); err != nil {
+			return err
+		}
+	}
+	s.locals = s.locals[:locals]
+
+	return nil
+}
+
+// deref writes code that dereferences pointers and returns the
+// dereferenced value and the number of blocks that were opened.
+func (s *genState) deref(v genVal) (genVal, int) {
+	closers := 0
+
+	for v.typ != nil && v.typ.Kind() == reflect.Ptr {
+		s.open("if %s != nil", v.expr)
+		closers++
+		v = genVal{"(*" + v.expr + ")", staticType(v.typ.Elem()), true}
+	}
+
+	return v, closers
+}
+
+// print writes code that writes v, HTML-escaped if escape is true.
+func (s *genState) print(v genVal, escape bool) {
+	if !v.valid {
+		return
+	}
+
+	if v.typ == nil {
+		s.check(fmt.Sprintf("err := %sGenPrint(w, %s, %t)", s.g.runtime(), v.expr, escape))
+		return
+	}
+
+	v, closers := s.deref(v)
+	switch {
+	case v.typ == nil:
+		s.check(fmt.Sprintf("err := %sGenPrint(w, %s, %t)", s.g.runtime(), v.expr, escape))
+	case escape && v.typ == reflect.TypeOf(""):
+		s.check(fmt.Sprintf("_, err := io.WriteString(w, %sEscapeHTML(%s))", s.g.runtime(), v.expr))
+	case escape:
+		s.check(fmt.Sprintf("_, err := io.WriteString(w, %sEscapeHTML(%s.Sprint(%s)))", s.g.runtime(), s.g.use("fmt"), v.expr))
+	case v.typ == reflect.TypeOf(""):
+		s.check(fmt.Sprintf("_, err := io.WriteString(w, %s)", v.expr))
+	default:
+		s.check(fmt.Sprintf("_, err := %s.Fprint(w, %s)", s.g.use("fmt"), v.expr))
+	}
+	s.close(closers)
+}
+
+// truth returns a boolean expression that is true if v is, like isTrue.
+// v must be dereferenced.
+func (s *genState) truth(v genVal) string {
+	if v.typ == nil {
+		return s.g.runtime() + "GenIsTrue(" + v.expr + ")"
+	}
+
+	switch v.typ.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return "len(" + v.expr + ") > 0"
+	case reflect.Func, reflect.Chan:
+		return v.expr + " != nil"
+	case reflect.Struct:
+		return "true"
+	case reflect.Bool:
+		return v.expr
+	}
+
+	return v.expr + " != 0"
+}
+
+func (s *genState) walkSection(n *sectionNode) error {
+	if _, ok := s.g.t.helper(n.Head); ok {
+		return s.errorf(n, "block helper %s is not supported in generated code", n.Name())
+	}
+
+	if n.Inverted {
+		t := s.tmpVar("t")
+		s.line("%s := false", t)
+
+		v, closers, err := s.evalExpression(n.Head, n.Tail)
+		if err != nil {
+			return err
+		}
+		if v.valid {
+			v, c := s.deref(v)
+			s.line("%s = %s", t, s.truth(v))
+			s.close(c)
+		}
+		s.close(closers)
+
+		s.open("if !%s", t)
+		if err := s.walkList(n.Children()); err != nil {
+			return err
+		}
+		if n.Else != nil {
+			s.indent--
+			s.line("} else {")
+			s.indent++
+			if err := s.walkList(n.Else.Children()); err != nil {
+				return err
+			}
+		}
+		s.close(1)
+		return nil
+	}
+
+	// r tells the else branch whether the section was rendered.
+	var r string
+	if n.Else != nil {
+		r = s.tmpVar("r")
+		s.line("%s := false", r)
+	}
+
+	v, closers, err := s.evalExpression(n.Head, n.Tail)
+	if err != nil {
+		return err
+	}
+	if !v.valid {
+		s.close(closers)
+		return s.walkElse(n, r)
+	}
+
+	v, c := s.deref(v)
+	closers += c
+
+	ctx := "c" + strconv.Itoa(len(s.stack))
+
+	switch {
+	case v.typ == nil:
+		k, i, l := s.tmpVar("k"), s.tmpVar("i"), s.tmpVar("n")
+		s.open("if err := %sGenSection(%s, %t, func(%s, %s interface{}, %s, %s int) error", s.g.runtime(), v.expr, n.PushMap, ctx, k, i, l)
+		s.rendered(r)
+
+		loop := genLoop{i, l, k, nil, true}
+		if len(s.loops) > 0 {
+			// The variables of the outer loop, if this doesn't iterate.
+			outer := s.loops[len(s.loops)-1]
+			s.open("if %s < 0", i)
+			s.line("%s, %s, %s = %s, %s, %s", k, i, l, outer.key, outer.index, outer.length)
+			s.close(1)
+			loop.maybe = outer.maybe
+		}
+
+		err = s.walkLoop(n.Children(), genCtx{ctx, nil, nil}, loop)
+		s.line("return nil")
+		s.indent--
+		s.line("}); err != nil {")
+		s.indent++
+		s.line("return err")
+		s.close(1)
+	case v.typ.Kind() == reflect.Slice || v.typ.Kind() == reflect.Array:
+		i := s.tmpVar("i")
+		s.open("for %s, %s := range %s", i, ctx, v.expr)
+		s.line("_, _ = %s, %s", i, ctx)
+		s.rendered(r)
+		err = s.walkLoop(n.Children(), genCtx{ctx, staticType(v.typ.Elem()), nil}, genLoop{i, "len(" + v.expr + ")", i, reflect.TypeOf(0), false})
+		s.close(1)
+	case v.typ.Kind() == reflect.Map && !n.PushMap:
+		keyType, terr := s.g.typeString(v.typ.Key())
+		if terr != nil {
+			return terr
+		}
+		i, k, key := s.tmpVar("i"), s.tmpVar("k"), s.tmpVar("k")
+		s.open("for %s, %s := range %sGenSortedKeys(%s)", i, k, s.g.runtime(), v.expr)
+		s.line("%s := %s.(%s)", key, k, keyType)
+		s.line("%s := %s[%s]", ctx, v.expr, key)
+		s.line("_, _, _ = %s, %s, %s", i, key, ctx)
+		s.rendered(r)
+		err = s.walkLoop(n.Children(), genCtx{ctx, staticType(v.typ.Elem()), nil}, genLoop{i, "len(" + v.expr + ")", key, v.typ.Key(), false})
+		s.close(1)
+	default:
+		s.open("if %s", s.truth(v))
+		s.rendered(r)
+		s.line("%s := %s", ctx, v.expr)
+		s.line("_ = %s", ctx)
+		err = s.walkPushed(n.Children(), genCtx{ctx, v.typ, nil})
+		s.close(1)
+	}
+
+	s.close(closers)
+	if err != nil {
+		return err
+	}
+	return s.walkElse(n, r)
+}
+
+// rendered writes code that sets r, if the section has an else branch.
+func (s *genState) rendered(r string) {
+	if r != "" {
+		s.line("%s = true", r)
+	}
+}
+
+// walkElse writes the else branch of n, which is rendered if r is false.
+func (s *genState) walkElse(n *sectionNode, r string) error {
+	if n.Else == nil {
+		return nil
+	}
+
+	s.open("if !%s", r)
+	err := s.walkList(n.Else.Children())
+	s.close(1)
+	return err
+}
+
+func (s *genState) walkPushed(nodes []Node, ctx genCtx) error {
+	s.stack = append(s.stack, ctx)
+	err := s.walkList(nodes)
+	s.stack = s.stack[:len(s.stack)-1]
+	return err
+}
+
+func (s *genState) walkLoop(nodes []Node, ctx genCtx, loop genLoop) error {
+	s.loops = append(s.loops, loop)
+	err := s.walkPushed(nodes, ctx)
+	s.loops = s.loops[:len(s.loops)-1]
+	return err
+}
+
+// variable returns the value of a variable like @index, like
+// state.variable. Nothing can be looked up in it.
+func (s *genState) variable(id *identifierNode) (genVal, int, error) {
+	name := id.path[0]
+	if !isVariable(name) {
+		return genVal{}, 0, s.errorf(id, "unknown variable %s", name)
+	}
+	if len(s.loops) == 0 || len(id.path) > 1 {
+		return genVal{}, 0, nil
+	}
+
+	l := s.loops[len(s.loops)-1]
+	closers := 0
+	if l.maybe {
+		s.open("if %s >= 0", l.index)
+		closers++
+	}
+
+	switch name {
+	case "@index":
+		return genVal{l.index, reflect.TypeOf(0), true}, closers, nil
+	case "@key":
+		return genVal{l.key, l.keyType, true}, closers, nil
+	case "@first":
+		return genVal{"(" + l.index + " == 0)", reflect.TypeOf(false), true}, closers, nil
+	case "@last":
+		return genVal{"(" + l.index + " == " + l.length + "-1)", reflect.TypeOf(false), true}, closers, nil
+	}
+
+	return genVal{l.length, reflect.TypeOf(0), true}, closers, nil
+}
+
+// partialArgs writes code that evaluates the context argument and the
+// parameters of a partial, like state.partialArgs, and returns the
+// context that is pushed, or that replaces the current one if there's
+// no context argument.
+func (s *genState) partialArgs(n *partialNode) (genCtx, error) {
+	top := s.stack[len(s.stack)-1]
+	ctx := genCtx{top.expr, top.typ, nil}
+	if n.Context != nil {
+		v, err := s.partialArg(n.Context)
+		if err != nil {
+			return ctx, err
+		}
+		ctx.expr, ctx.typ = v.expr, v.typ
+	}
+
+	for _, p := range n.Params {
+		v, err := s.partialArg(p.Value)
+		if err != nil {
+			return ctx, err
+		}
+		ctx.params = append(ctx.params, genParam{p.Key, v})
+	}
+	if n.Context == nil {
+		for _, p := range top.params {
+			if _, ok := ctx.param(p.key); !ok {
+				ctx.params = append(ctx.params, p)
+			}
+		}
+	}
+
+	return ctx, nil
+}
+
+// partialArg writes code that evaluates an argument of a partial and
+// returns the variable that holds it. It's an interface{} if the value
+// may be missing.
+func (s *genState) partialArg(node Node) (genVal, error) {
+	id, ok := node.(*identifierNode)
+	if !ok {
+		switch node.(type) {
+		case *binaryNode, *unaryNode, *callNode:
+			return s.operand(node)
+		}
+		return s.literal(node)
+	}
+
+	mark, indent := s.buf.Len(), s.indent
+	v, closers, err := s.resolve(id, true)
+	if err != nil {
+		return v, err
+	}
+	if v.valid {
+		v = s.call(id, v, nil)
+	}
+
+	return s.hold(v, closers, mark, indent), nil
+}
+
+// hold writes code that keeps v in a variable and closes the blocks that
+// were opened to find it, since the buffer was at mark and the indent
+// was indent. The variable is an interface{} if v may be missing.
+func (s *genState) hold(v genVal, closers, mark, indent int) genVal {
+	a := s.tmpVar("a")
+	if closers == 0 && v.valid {
+		s.line("%s := %s", a, v.expr)
+		return genVal{a, v.typ, true}
+	}
+
+	if v.valid {
+		s.line("%s = %s", a, v.expr)
+	}
+	s.close(closers)
+
+	// Declare the variable before the blocks that find the value.
+	code := append([]byte(nil), s.buf.Bytes()[mark:]...)
+	s.buf.Truncate(mark)
+	s.indent, indent = indent, s.indent
+	s.line("var %s interface{}", a)
+	s.buf.Write(code)
+	s.indent = indent
+
+	return genVal{a, nil, true}
+}
+
+// operand writes code that evaluates an operand of an operator, like
+// state.evalArg, and returns the variable that holds it.
+func (s *genState) operand(node Node) (genVal, error) {
+	switch n := node.(type) {
+	case *binaryNode:
+		return s.binary(n)
+	case *unaryNode:
+		return s.unary(n)
+	case *callNode:
+		mark, indent := s.buf.Len(), s.indent
+		v, closers, err := s.evalExpression(n.Func, n.Args)
+		if err != nil {
+			return v, err
+		}
+		return s.hold(v, closers, mark, indent), nil
+	}
+
+	return s.partialArg(node)
+}
+
+// binary writes code that evaluates a binary operator, like
+// state.evalBinary. &&, || and ?? only evaluate the right operand
+// when it's needed.
+func (s *genState) binary(n *binaryNode) (genVal, error) {
+	a, err := s.operand(n.Left)
+	if err != nil {
+		return a, err
+	}
+
+	r := s.tmpVar("v")
+
+	switch n.Op {
+	case "&&", "||":
+		if n.Op == "&&" {
+			s.line("%s := false", r)
+			s.open("if %s", s.isTrue(a))
+		} else {
+			s.line("%s := true", r)
+			s.open("if !%s", s.isTrue(a))
+		}
+		b, err := s.operand(n.Right)
+		if err != nil {
+			return b, err
+		}
+		s.line("%s = %s", r, s.isTrue(b))
+		s.close(1)
+		return genVal{r, reflect.TypeOf(false), true}, nil
+	case "??":
+		s.line("var %s interface{} = %s", r, a.expr)
+		s.open("if %sGenIsMissing(%s)", s.g.runtime(), r)
+		b, err := s.operand(n.Right)
+		if err != nil {
+			return b, err
+		}
+		s.line("%s = %s", r, b.expr)
+		s.close(1)
+		return genVal{r, nil, true}, nil
+	}
+
+	b, err := s.operand(n.Right)
+	if err != nil {
+		return b, err
+	}
+
+	s.line("%s, err := %sGenBinary(%q, %d, %q, %s, %s)", r, s.g.runtime(), s.name, n.Position(), n.Op, a.expr, b.expr)
+	s.open("if err != nil")
+	s.line("return err")
+	s.close(1)
+
+	return genVal{r, nil, true}, nil
+}
+
+// unary writes code that evaluates a unary operator.
+func (s *genState) unary(n *unaryNode) (genVal, error) {
+	a, err := s.operand(n.Operand)
+	if err != nil {
+		return a, err
+	}
+
+	r := s.tmpVar("v")
+	if n.Op == "!" {
+		s.line("%s := !%s", r, s.isTrue(a))
+		return genVal{r, reflect.TypeOf(false), true}, nil
+	}
+
+	s.line("%s, err := %sGenUnary(%q, %d, %q, %s)", r, s.g.runtime(), s.name, n.Position(), n.Op, a.expr)
+	s.open("if err != nil")
+	s.line("return err")
+	s.close(1)
+
+	return genVal{r, nil, true}, nil
+}
+
+// isTrue returns a boolean expression that is true if v is, like
+// truth, for a value that may be a pointer.
+func (s *genState) isTrue(v genVal) string {
+	if v.typ != nil && v.typ.Kind() == reflect.Ptr {
+		return s.g.runtime() + "GenIsTrue(" + v.expr + ")"
+	}
+	return "(" + s.truth(v) + ")"
+}
+
+// evalExpression writes code that evaluates an expression. The value can
+// be used inside the returned number of blocks, which the caller closes.
+func (s *genState) evalExpression(head Node, tail []Node) (genVal, int, error) {
+	id, ok := head.(*identifierNode)
+	if !ok {
+		switch head.(type) {
+		case *binaryNode, *unaryNode, *callNode:
+			v, err := s.operand(head)
+			return v, 0, err
+		}
+		v, err := s.literal(head)
+		return v, 0, err
+	}
+
+	v, closers, err := s.resolve(id, len(tail) == 0)
+	if err != nil || !v.valid {
+		return v, closers, err
+	}
+
+	if len(tail) == 0 {
+		return s.call(id, v, nil), closers, nil
+	}
+
+	if v.typ == nil {
+		return v, closers, s.errorf(id, "cannot call %s with arguments, it is an interface{}", id.Name())
+	}
+	if v.typ.Kind() != reflect.Func {
+		// The arguments are ignored, like call does.
+		return v, closers, nil
+	}
+	if _, ok := callType(v.typ, len(tail)); !ok {
+		s.line("_ = %s", v.expr)
+		s.runtimeError(id, "cannot call %s with %d arguments", id.Name(), len(tail))
+		return genVal{}, closers, nil
+	}
+
+	args := make([]string, len(tail))
+	for i, n := range tail {
+		var t reflect.Type
+		if v.typ.IsVariadic() && i >= v.typ.NumIn()-1 {
+			t = v.typ.In(v.typ.NumIn() - 1).Elem()
+		} else {
+			t = v.typ.In(i)
+		}
+
+		if args[i], err = s.arg(n, t); err != nil {
+			return v, closers, err
+		}
+	}
+
+	return s.call(id, v, args), closers, nil
+}
+
+// arg writes code that evaluates the argument node
+// as type typ and returns the variable that holds it.
+func (s *genState) arg(node Node, typ reflect.Type) (string, error) {
+	typeName, err := s.g.typeString(typ)
+	if err != nil {
+		return "", err
+	}
+
+	a := s.tmpVar("a")
+	s.line("var %s %s", a, typeName)
+
+	var (
+		v       genVal
+		closers int
+	)
+
+	switch n := node.(type) {
+	case *identifierNode:
+		if v, closers, err = s.resolve(n, true); err != nil {
+			return "", err
+		}
+		if v.valid {
+			v = s.call(n, v, nil)
+		}
+	case *binaryNode, *unaryNode, *callNode:
+		if v, err = s.operand(n); err != nil {
+			return "", err
+		}
+	default:
+		v, err := s.literal(node)
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case v.typ == nil:
+			// nil leaves the zero value.
+		case !v.typ.ConvertibleTo(typ):
+			return "", s.errorf(node, "cannot use %s as %s", v.expr, typ)
+		default:
+			s.line("%s = %s(%s)", a, typeName, v.expr)
+		}
+		return a, nil
+	}
+
+	switch {
+	case !v.valid:
+	case v.typ == nil:
+		s.line("%s, _ = %s.(%s)", a, v.expr, typeName)
+	case v.typ.AssignableTo(typ):
+		s.line("%s = %s", a, v.expr)
+	case v.typ.ConvertibleTo(typ):
+		s.line("%s = %s(%s)", a, typeName, v.expr)
+	default:
+		return "", s.errorf(node, "cannot use %s (%s) as %s", argString(node), v.typ, typ)
+	}
+
+	s.close(closers)
+	return a, nil
+}
+
+func (s *genState) literal(node Node) (genVal, error) {
+	switch n := node.(type) {
+	case *stringNode:
+		return genVal{strconv.Quote(n.Text), reflect.TypeOf(""), true}, nil
+	case *numberNode:
+		v, err := parseNumber(n.Text)
+		if err != nil {
+			return genVal{}, s.errorf(n, "%v", err)
+		}
+		typ := reflect.TypeOf(v)
+		return genVal{typ.String() + "(" + n.Text + ")", typ, true}, nil
+	case *boolNode:
+		return genVal{strconv.FormatBool(n.True), reflect.TypeOf(false), true}, nil
+	case *nilNode:
+		return genVal{"interface{}(nil)", nil, true}, nil
+	case *sliceNode:
+		items, err := s.literalItems(n.Items)
+		if err != nil {
+			return genVal{}, err
+		}
+		r := s.tmpVar("v")
+		s.line("%s := []interface{}{%s}", r, strings.Join(items, ", "))
+		return genVal{r, reflect.TypeOf([]interface{}(nil)), true}, nil
+	case *mapNode:
+		values, err := s.literalItems(n.Values)
+		if err != nil {
+			return genVal{}, err
+		}
+		for i, key := range n.Keys {
+			values[i] = strconv.Quote(key) + ": " + values[i]
+		}
+		r := s.tmpVar("v")
+		s.line("%s := map[string]interface{}{%s}", r, strings.Join(values, ", "))
+		return genVal{r, reflect.TypeOf(map[string]interface{}(nil)), true}, nil
+	}
+
+	return genVal{}, s.errorf(node, "unexpected argument: %s", node.Type())
+}
+
+// literalItems writes code that evaluates the elements of a list or
+// map literal and returns the variables that hold them.
+func (s *genState) literalItems(nodes []Node) ([]string, error) {
+	items := make([]string, len(nodes))
+	for i, n := range nodes {
+		v, err := s.partialArg(n)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = v.expr
+	}
+	return items, nil
+}
+
+// call writes code that calls v with args if v is a function, like call.
+func (s *genState) call(id *identifierNode, v genVal, args []string) genVal {
+	if v.typ == nil || v.typ.Kind() != reflect.Func {
+		return v
+	}
+
+	if _, ok := callType(v.typ, len(args)); !ok {
+		s.line("_ = %s", v.expr)
+		s.runtimeError(id, "cannot call %s with %d arguments", id.Name(), len(args))
+		return genVal{}
+	}
+
+	r := s.tmpVar("v")
+	expr := v.expr + "(" + strings.Join(args, ", ") + ")"
+
+	if v.typ.NumOut() == 2 {
+		s.line("%s, err := %s", r, expr)
+		s.open("if err != nil")
+		s.line("return %s.Errorf(\"%%s%%v\", %q, err)", s.g.use("fmt"), s.errorf(id, "%s: ", id.Name()).Error())
+		s.close(1)
+	} else {
+		s.line("%s := %s", r, expr)
+	}
+
+	if out := v.typ.Out(0); out == errorType {
+		s.open("if %s != nil", r)
+		s.line("return %s.Errorf(\"%%s%%v\", %q, %s)", s.g.use("fmt"), s.errorf(id, "%s: ", id.Name()).Error(), r)
+		s.close(1)
+	}
+
+	return genVal{r, staticType(v.typ.Out(0)), true}
+}
+
+// resolve writes code that resolves the path of an identifier, like
+// state.evalIdentifier, except that the last element is not called.
+// If last is true and the path can't be resolved statically, it is
+// resolved and called at run time.
+func (s *genState) resolve(id *identifierNode, last bool) (genVal, int, error) {
+	var (
+		v       genVal
+		closers int
+		path    = id.path[1:]
+	)
+
+	if i, rest, ok := id.anchor(len(s.stack)); ok {
+		if i < 0 {
+			return genVal{}, 0, nil
+		}
+		c := s.stack[i]
+		v, path = genVal{c.expr, c.typ, true}, rest
+		if len(rest) > 0 {
+			if p, ok := c.param(rest[0]); ok {
+				v, path = p, rest[1:]
+			}
+		}
+	} else if strings.HasPrefix(id.path[0], "@") {
+		return s.variable(id)
+	} else {
+		for i := len(s.locals) - 1; i >= 0 && !v.valid; i-- {
+			if s.locals[i].name == id.path[0] {
+				v = s.locals[i].v
+			}
+		}
+	}
+
+	for i := len(s.stack) - 1; i >= 0 && !v.valid; i-- {
+		c := s.stack[i]
+
+		if p, ok := c.param(id.path[0]); ok {
+			v = p
+			break
+		}
+		if c.typ == nil {
+			return s.dynamic(id, s.stackExprs(s.stack[:i+1]), id.path, last)
+		}
+
+		if _, ok := lookupType(c.typ, id.path[0]); ok {
+			if !resolvable(c.typ, id.path) {
+				// The path is found in this context, but the rest
+				// of it can never be found.
+				return genVal{}, 0, nil
+			}
+
+			var (
+				n   int
+				err error
+			)
+			v, n, err = s.step(genVal{c.expr, c.typ, true}, id.path[0])
+			closers += n
+			if err != nil {
+				return v, closers, err
+			}
+		}
+	}
+
+	if !v.valid {
+		return v, closers, nil
+	}
+
+	for i, name := range path {
+		v = s.call(id, v, nil)
+
+		if v.typ == nil {
+			d, n, err := s.dynamic(id, v.expr, path[i:], last)
+			return d, closers + n, err
+		}
+
+		var (
+			n   int
+			err error
+		)
+		v, n, err = s.step(v, name)
+		closers += n
+		if err != nil {
+			return v, closers, err
+		}
+	}
+
+	return v, closers, nil
+}
+
+// resolvable reports whether path can be found in values of type typ,
+// which is the case if every element is found or if the element is
+// in a value that is an interface.
+func resolvable(typ reflect.Type, path []string) bool {
+	for i, name := range path {
+		if i > 0 {
+			var ok bool
+			if typ, ok = callType(typ, 0); !ok {
+				return false
+			}
+		}
+		if typ == nil {
+			return true
+		}
+
+		var ok bool
+		if typ, ok = lookupType(typ, name); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// dynamic writes code that resolves path at run time in the
+// contexts expr, which is a Go expression of type []interface{}.
+func (s *genState) dynamic(id *identifierNode, expr string, path []string, last bool) (genVal, int, error) {
+	if !last {
+		return genVal{}, 0, s.errorf(id, "cannot call %s with arguments, it is an interface{}", id.Name())
+	}
+
+	if !strings.HasPrefix(expr, "[]interface{}") {
+		expr = "[]interface{}{" + expr + "}"
+	}
+
+	quoted := make([]string, len(path))
+	for i, p := range path {
+		quoted[i] = strconv.Quote(p)
+	}
+
+	r := s.tmpVar("v")
+	s.line("%s, err := %sGenLookup(%q, %d, %s, %s)", r, s.g.runtime(), s.name, id.Position(), expr, strings.Join(quoted, ", "))
+	s.open("if err != nil")
+	s.line("return err")
+	s.close(1)
+
+	return genVal{r, nil, true}, 0, nil
+}
+
+// stackExprs returns the expression of a context stack for GenLookup.
+func (s *genState) stackExprs(stack []genCtx) string {
+	exprs := make([]string, len(stack))
+	for i, c := range stack {
+		exprs[i] = c.expr
+		if len(c.params) == 0 {
+			continue
+		}
+
+		params := make([]string, len(c.params))
+		for j, p := range c.params {
+			params[j] = strconv.Quote(p.key) + ": " + p.v.expr
+		}
+		exprs[i] = fmt.Sprintf("%sGenScope{%s, map[string]interface{}{%s}}", s.g.runtime(), c.expr, strings.Join(params, ", "))
+	}
+	return "[]interface{}{" + strings.Join(exprs, ", ") + "}"
+}
+
+// step writes code that looks up name in v, like lookup.
+// lookupType must have found name in the type of v.
+func (s *genState) step(v genVal, name string) (genVal, int, error) {
+	name = segmentKey(name)
+	if m, ok := v.typ.MethodByName(name); ok {
+		return genVal{v.expr + "." + name, methodType(v.typ, m), true}, 0, nil
+	}
+
+	v, closers := s.deref(v)
+	typ := v.typ
+	r := s.tmpVar("v")
+
+	switch typ.Kind() {
+	case reflect.Struct:
+		if m, ok := reflect.PointerTo(typ).MethodByName(name); ok {
+			if _, isField := typ.FieldByName(name); !isField {
+				// The receiver must be addressable.
+				s.line("%s := %s", r, v.expr)
+				return genVal{r + "." + name, methodType(typ, m), true}, closers, nil
+			}
+		}
+		f, _ := typ.FieldByName(name)
+		s.line("%s := %s.%s", r, v.expr, name)
+		return genVal{r, staticType(f.Type), true}, closers, nil
+	case reflect.Map:
+		key := strconv.Quote(name)
+		if typ.Key() != reflect.TypeOf("") {
+			typeName, err := s.g.typeString(typ.Key())
+			if err != nil {
+				return genVal{}, closers, err
+			}
+			key = typeName + "(" + key + ")"
+		}
+		s.open("if %s, ok := %s[%s]; ok", r, v.expr, key)
+		return genVal{r, staticType(typ.Elem()), true}, closers + 1, nil
+	case reflect.Slice, reflect.Array:
+		index, _ := strconv.Atoi(name)
+		i := s.tmpVar("i")
+		if index < 0 {
+			s.line("%s := len(%s) - %d", i, v.expr, -index)
+		} else {
+			s.line("%s := %d", i, index)
+		}
+		s.open("if %s >= 0 && %s < len(%s)", i, i, v.expr)
+		s.line("%s := %s[%s]", r, v.expr, i)
+		return genVal{r, staticType(typ.Elem()), true}, closers + 1, nil
+	}
+
+	return genVal{}, closers, fmt.Errorf("template: %s: cannot look up %s in %s", s.name, name, typ)
+}
+
+// The functions below are used by generated code for values that are
+// typed as interfaces. They are not meant to be called otherwise.
+
+// GenScope is a context with the parameters of a partial, in a stack
+// that is passed to GenLookup.
+type GenScope struct {
+	Context interface{}
+	Params  map[string]interface{}
+}
+
+// GenLookup resolves path in stack like Execute does, for the template
+// name at pos.
+func GenLookup(name string, pos Pos, stack []interface{}, path ...string) (interface{}, error) {
+	s := &state{name: name}
+	for _, v := range stack {
+		sc, ok := v.(GenScope)
+		if !ok {
+			s.push(reflect.ValueOf(v))
+			continue
+		}
+
+		params := make(map[string]reflect.Value, len(sc.Params))
+		for k, p := range sc.Params {
+			params[k] = reflect.ValueOf(p)
+		}
+		s.pushParams(reflect.ValueOf(sc.Context), params)
+	}
+
+	v, err := s.evalIdentifier(newIdentifier(pos, path), nil)
+	if err != nil || !v.IsValid() {
+		return nil, err
+	}
+
+	return v.Interface(), nil
+}
+
+// GenBinary applies the binary operator op to a and b like Execute
+// does, for the template name at pos.
+func GenBinary(name string, pos Pos, op string, a, b interface{}) (interface{}, error) {
+	v, err := binaryOp(op, reflect.ValueOf(a), reflect.ValueOf(b))
+	return genResult(name, pos, v, err)
+}
+
+// GenUnary applies the unary operator op to a like Execute does, for
+// the template name at pos.
+func GenUnary(name string, pos Pos, op string, a interface{}) (interface{}, error) {
+	v, err := unaryOp(op, reflect.ValueOf(a))
+	return genResult(name, pos, v, err)
+}
+
+// GenIsMissing reports whether v is missing or nil, in which
+// case ?? returns its right operand.
+func GenIsMissing(v interface{}) bool {
+	return !indirect(reflect.ValueOf(v)).IsValid()
+}
+
+func genResult(name string, pos Pos, v reflect.Value, err error) (interface{}, error) {
+	if err != nil {
+		return nil, fmt.Errorf("template: %s:@%d: %v", name, pos, err)
+	}
+	if !v.IsValid() {
+		return nil, nil
+	}
+	return v.Interface(), nil
+}
+
+// GenPrint writes v like Execute does, HTML-escaped if escape is true.
+func GenPrint(w io.Writer, v interface{}, escape bool) error {
+	s := &state{wr: w}
+	return s.print(reflect.ValueOf(v), escape)
+}
+
+// GenText writes text of a template that is rendered in an
+// indented partial.
+func GenText(w io.Writer, text []byte) error {
+	if iw, ok := w.(*indentWriter); ok {
+		return iw.writeText(string(text))
+	}
+	_, err := w.Write(text)
+	return err
+}
+
+// GenIndent calls fn to render an indented partial.
+func GenIndent(w io.Writer, s string, fn func(w io.Writer) error) error {
+	return indent(w, s, fn)
+}
+
+// GenIsTrue reports whether a section renders v.
+func GenIsTrue(v interface{}) bool {
+	return isTrue(reflect.ValueOf(v))
+}
+
+// GenSection calls fn for each context that a section renders for v,
+// with the key, index and length of lists and maps, or -1 if v isn't
+// iterated. Maps are pushed once if pushMap is true.
+func GenSection(v interface{}, pushMap bool, fn func(ctx, key interface{}, index, length int) error) error {
+	rv := reflect.ValueOf(v)
+	if !isTrue(rv) {
+		return nil
+	}
+
+	rv = indirect(rv)
+
+	switch {
+	case rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if err := fn(rv.Index(i).Interface(), i, i, rv.Len()); err != nil {
+				return err
+			}
+		}
+		return nil
+	case rv.Kind() == reflect.Map && !pushMap:
+		keys := sortedKeys(rv)
+		for i, k := range keys {
+			if err := fn(rv.MapIndex(k).Interface(), k.Interface(), i, len(keys)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return fn(rv.Interface(), nil, -1, -1)
+}
+
+// GenSortedKeys returns the keys of the map m in the order in which
+// a section iterates them.
+func GenSortedKeys(m interface{}) []interface{} {
+	keys := sortedKeys(reflect.ValueOf(m))
+	r := make([]interface{}, len(keys))
+	for i, k := range keys {
+		r[i] = k.Interface()
+	}
+	return r
+}
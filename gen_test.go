@@ -0,0 +1,273 @@
+package template
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	goparser "go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// genDynTests are rendered with genDynData, whose values are all
+// interface{} and must be resolved at run time.
+var genDynTests = []struct {
+	name  string
+	input string
+}{
+	{"dyn-variable", "((title)) ((user.Name)) ((nope.x))"},
+	{"dyn-section", "((#items))<((name))((title))>((/items))"},
+	{"dyn-inverted", "((^empty))none((/empty))((^title))x((/title))"},
+	{"dyn-method", `((#user))((Initial))((/user))`},
+	{"dyn-partial", "((#items))((>item))((/items))"},
+	{"dyn-operators", `((title == "Dyn")) ((nope ?? title)) ((#user.Name != "" && !empty))ok((/)) ((user.Name + "!"))`},
+	{"dyn-else", "((#empty))x((else))none((/empty)) ((#nope.x))x((else))no((/nope.x)) ((#items))((name))((else))x((/items))"},
+	{"dyn-let", "((let t = title))((t)) ((let u = user))((u.Name)) ((#items))((let n = name))((n))((/items))[((n))]"},
+	{"dyn-map", "((#items))((#.))((@index)):((@key))=((.))((/.))((#name))(((@key)))((/name));((/items))"},
+	{"dyn-partial-params", "((#items))((>item_label label=name n=user.Name))((/items))((>item_label user label=title))"},
+}
+
+var genDynTemplates = map[string]string{
+	"item":       "[((name))]",
+	"item_label": "[((label)) ((n)) ((Name))]",
+}
+
+// genMustacheTests are parsed with MustacheOptions and rendered
+// with execTestData.
+var genMustacheTests = []struct {
+	name  string
+	input string
+}{
+	{"mustache-escape", `{{"<a&b>"}} {{{"<a&b>"}}} {{&"<a&b>"}} {{Count}} {{User.Meta}}`},
+	{"mustache-dot", "{{#Users}}{{#Name}}({{.}}){{/Name}}{{/Users}}{{#User}}{{#Admin}}{{.}}{{/Admin}}{{/User}}"},
+	{"mustache-else", "{{#Nope}}\nx\n{{^}}\ny\n{{/Nope}}\n{{#Count}}\n{{^}}\nz\n{{/Count}}\n"},
+	{"mustache-map", "{{#User.Meta}}{{age}}{{/User.Meta}}"},
+	{"mustache-keywords", "[{{else}}][{{true}}]\n{{#nil}}\nx\n{{/nil}}\n"},
+	{"mustache-partial", "<\n  {{>mustache_indented}}\n{{>nope}}>"},
+}
+
+var genMustacheTemplates = map[string]string{
+	"mustache_indented": "a\n{{#Users}}\n{{Name}}\n  {{>mustache_inner}}\n{{/Users}}\n",
+	"mustache_inner":    "[{{Name}}]\n",
+}
+
+var genDynData = map[string]interface{}{
+	"title": "Dyn",
+	"items": []interface{}{map[string]interface{}{"name": "a"}, map[string]string{"name": "b"}},
+	"user":  &execUser{Name: "Ann"},
+	"empty": []int{},
+}
+
+func parseOptions(t testing.TB, name string, options *Options, src string) Node {
+	n, err := ParseOptions(name, options, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestExportedName(t *testing.T) {
+	tests := map[string]string{
+		"page":             "Page",
+		"users/list.html":  "UsersListHtml",
+		"method-args":      "MethodArgs",
+		"admin/_form.tmpl": "AdminFormTmpl",
+	}
+
+	for name, expected := range tests {
+		if got := exportedName(name); got != expected {
+			t.Errorf("%s: got %q, expected %q", name, got, expected)
+		}
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tmpl := parseTemplates(t, map[string]string{"a": "((>nope))", "b": "x", "B": "y", "c": "((>*d))"})
+
+	tests := []struct {
+		types map[string]reflect.Type
+		err   string
+	}{
+		{map[string]reflect.Type{"a": reflect.TypeOf("")}, "template not available: nope"},
+		{map[string]reflect.Type{"b": reflect.TypeOf(""), "B": reflect.TypeOf("")}, "both generate RenderB"},
+		{map[string]reflect.Type{"b": reflect.TypeOf(execData{})}, "unexported type template.execData"},
+		{map[string]reflect.Type{"c": reflect.TypeOf("")}, "dynamic partial *d is not supported"},
+	}
+
+	for _, test := range tests {
+		err := tmpl.Generate(&bytes.Buffer{}, &GenerateOptions{Package: "views", PkgPath: "example.com/views", Types: test.types})
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("got error %v, expected %q", err, test.err)
+		}
+	}
+}
+
+func TestGenerateImports(t *testing.T) {
+	tests := []struct {
+		input   string
+		data    interface{}
+		imports []string
+	}{
+		{"hello", 0, []string{`"io"`}},
+		{"((.))", 0, []string{`"fmt"`, `"io"`}},
+		{"((#.))x((/.))", 0, []string{`"io"`}},
+		{"((#x))x((/x))", genDynData, []string{`"github.com/FSX/template"`, `"io"`}},
+	}
+
+	for _, test := range tests {
+		tmpl := parseTemplates(t, map[string]string{"a": test.input})
+
+		var buf bytes.Buffer
+		err := tmpl.Generate(&buf, &GenerateOptions{Package: "views", PkgPath: "example.com/views", Types: map[string]reflect.Type{"a": reflect.TypeOf(test.data)}})
+		if err != nil {
+			t.Fatalf("%q: %v", test.input, err)
+		}
+
+		f, err := goparser.ParseFile(token.NewFileSet(), "a.go", buf.Bytes(), goparser.ImportsOnly)
+		if err != nil {
+			t.Fatalf("%q: %v", test.input, err)
+		}
+
+		var imports []string
+		for _, spec := range f.Imports {
+			imports = append(imports, spec.Path.Value)
+		}
+		if !reflect.DeepEqual(imports, test.imports) {
+			t.Errorf("%q: got imports %v, expected %v", test.input, imports, test.imports)
+		}
+	}
+}
+
+// TestGenerate renders the execute tests with generated code and
+// compares the results to those of Execute. The generated code is
+// added to a copy of this package in a temporary GOPATH, so that it
+// can use the unexported test types.
+func TestGenerate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not found")
+	}
+
+	nodes := make(map[string]Node)
+	types := make(map[string]reflect.Type)
+	expected := make(map[string][2]string)
+
+	add := func(name, input string, templates map[string]string, data interface{}, options *Options) {
+		all := make(map[string]Node)
+		for k, v := range templates {
+			all[k] = parseOptions(t, k, options, v)
+		}
+		all[name] = parseOptions(t, name, options, input)
+		for k, v := range all {
+			nodes[k] = v
+		}
+		types[name] = reflect.TypeOf(data)
+
+		var buf bytes.Buffer
+		err := New(NewNodeMap(all)).Execute(&buf, name, data)
+		expected[name] = [2]string{buf.String(), fmt.Sprint(err)}
+	}
+
+	for _, test := range execTests {
+		// Missing templates, unknown variables and dynamic partials
+		// fail to generate.
+		if !strings.Contains(test.err, "not available") && !strings.Contains(test.err, "unknown variable") && !strings.Contains(test.input, "> *") {
+			add(test.name, test.input, execTemplates, execTestData, nil)
+		}
+	}
+	for _, test := range genDynTests {
+		add(test.name, test.input, genDynTemplates, genDynData, nil)
+	}
+	for _, test := range genMustacheTests {
+		add(test.name, test.input, genMustacheTemplates, execTestData, MustacheOptions())
+	}
+
+	var gen bytes.Buffer
+	err = New(NewNodeMap(nodes)).Generate(&gen, &GenerateOptions{
+		Package: "template",
+		PkgPath: templatePkgPath,
+		Types:   types,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var driver strings.Builder
+	driver.WriteString("package template\n\nimport (\n\t\"bytes\"\n\t\"encoding/json\"\n\t\"fmt\"\n\t\"testing\"\n)\n\n")
+	driver.WriteString("func TestGenerated(t *testing.T) {\n\tresults := make(map[string][2]string)\n\tvar buf bytes.Buffer\n\tvar err error\n")
+	for name, typ := range types {
+		data := "execTestData"
+		if typ == reflect.TypeOf(genDynData) {
+			data = "genDynData"
+		}
+		fmt.Fprintf(&driver, "\tbuf.Reset()\n\terr = Render%s(&buf, %s)\n\tresults[%q] = [2]string{buf.String(), fmt.Sprint(err)}\n", exportedName(name), data, name)
+	}
+	driver.WriteString("\tb, _ := json.Marshal(results)\n\tfmt.Printf(\"results: %s\\n\", b)\n}\n")
+
+	gopath := t.TempDir()
+	dir := filepath.Join(gopath, "src", filepath.FromSlash(templatePkgPath))
+	if err := os.MkdirAll(filepath.Join(dir, "internal", "tmplfile"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var files []string
+	for _, pattern := range []string{"*.go", filepath.Join("internal", "tmplfile", "*.go")} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, matches...)
+	}
+	for _, fn := range files {
+		if strings.HasSuffix(fn, "_test.go") && fn != "exec_test.go" && fn != "gen_test.go" {
+			continue
+		}
+		b, err := os.ReadFile(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, fn), b, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "generated.go"), gen.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "generated_test.go"), []byte(driver.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(goTool, "test", "-vet=off", "-count=1", "-v", "-run", "^TestGenerated$", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOPATH="+gopath, "GO111MODULE=off", "GOFLAGS=")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v\n%s\n%s", err, out, gen.String())
+	}
+
+	var results map[string][2]string
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, "results: ") {
+			if err := json.Unmarshal([]byte(line[len("results: "):]), &results); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for name, exp := range expected {
+		if got, ok := results[name]; !ok {
+			t.Errorf("%s: no result", name)
+		} else if got != exp {
+			t.Errorf("%s: got\n\t%q\nexpected\n\t%q", name, got, exp)
+		}
+	}
+}
@@ -2,37 +2,85 @@ package template
 
 import (
 	"fmt"
+	"io/fs"
 	"io/ioutil"
+	"path"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
+
+	"github.com/FSX/template/internal/tmplfile"
 )
 
 type Options struct {
 	LeftDelim, RightDelim string
 	StripExtension        bool
+	CacheDir              string // Directory for parsed trees; no caching if empty.
+	Mustache              bool   // Parse standard Mustache; see MustacheOptions.
+	KebabCase             bool   // Allow hyphens in identifiers, like created-at.
 }
 
+// NodeMap is a NodeStorage that is safe for concurrent use. Reads take
+// no lock: they use an immutable snapshot of the map, which is replaced
+// atomically by a copy on every write.
 type NodeMap struct {
-	sync.RWMutex
-	m map[string]Node
+	mu sync.Mutex // Serializes writers.
+	m  atomic.Pointer[map[string]Node]
+}
+
+// NewNodeMap returns a NodeMap that holds the templates in m. The
+// NodeMap takes ownership of m.
+func NewNodeMap(m map[string]Node) *NodeMap {
+	n := &NodeMap{}
+	n.m.Store(&m)
+	return n
 }
 
 func (n *NodeMap) Get(name string) (Node, bool) {
-	n.Lock()
-	defer n.Unlock()
+	if m := n.m.Load(); m != nil {
+		p, ok := (*m)[name]
+		return p, ok
+	}
+	return nil, false
+}
 
-	if p, ok := n.m[name]; ok {
-		return p, true
+func (n *NodeMap) Set(name string, p Node) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var m map[string]Node
+	if old := n.m.Load(); old != nil {
+		m = make(map[string]Node, len(*old)+1)
+		for k, v := range *old {
+			m[k] = v
+		}
 	} else {
-		return nil, false
+		m = make(map[string]Node)
+	}
+
+	m[name] = p
+	n.m.Store(&m)
+}
+
+// Snapshot returns a read-only view of the templates as they are now.
+func (n *NodeMap) Snapshot() NodeStorage {
+	if m := n.m.Load(); m != nil {
+		return nodeSnapshot(*m)
 	}
+	return nodeSnapshot(nil)
 }
 
-func (n *NodeMap) Set(name string, p Node) {
-	n.Lock()
-	n.m[name] = p
-	n.Unlock()
+// nodeSnapshot is a read-only NodeStorage.
+type nodeSnapshot map[string]Node
+
+func (s nodeSnapshot) Get(name string) (Node, bool) {
+	n, ok := s[name]
+	return n, ok
+}
+
+func (s nodeSnapshot) Set(name string, n Node) {
+	panic("template: cannot set " + name + " in a snapshot")
 }
 
 func ParseFiles(options *Options, basedir string, filenames ...string) (*Template, error) {
@@ -42,7 +90,7 @@ func ParseFiles(options *Options, basedir string, filenames ...string) (*Templat
 
 	m := make(map[string]Node)
 	if options == nil {
-		options = &Options{"", "", false}
+		options = &Options{}
 	}
 
 	for _, fn := range filenames {
@@ -53,31 +101,145 @@ func ParseFiles(options *Options, basedir string, filenames ...string) (*Templat
 			return nil, err
 		}
 
-		n, err := Parse(fn, options.LeftDelim, options.RightDelim, string(b))
+		if err := parseInto(m, options, fn, string(b)); err != nil {
+			return nil, err
+		}
+	}
+
+	return New(NewNodeMap(m)), nil
+}
+
+// ParseFS parses the files in fsys that match one of the patterns. The
+// patterns use the syntax of path.Match, with the addition of "**", which
+// matches zero or more directories. Templates are named by their
+// slash-separated path relative to the root of fsys.
+func ParseFS(options *Options, fsys fs.FS, patterns ...string) (*Template, error) {
+	if len(patterns) == 0 {
+		return nil, fmt.Errorf("template: no patterns named in call to ParseFS")
+	}
+
+	m := make(map[string]Node)
+	if options == nil {
+		options = &Options{}
+	}
+
+	filenames, err := globFS(fsys, patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fn := range filenames {
+		b, err := fs.ReadFile(fsys, fn)
 		if err != nil {
 			return nil, err
 		}
 
-		if options.StripExtension {
-			m[stripExt(fn)] = n
-		} else {
-			m[fn] = n
+		if err := parseInto(m, options, fn, string(b)); err != nil {
+			return nil, err
 		}
+	}
 
+	return New(NewNodeMap(m)), nil
+}
+
+// parseInto parses the template in file fn and stores it in m.
+func parseInto(m map[string]Node, options *Options, fn, src string) error {
+	n, err := parseCached(options, fn, src)
+	if err != nil {
+		return err
 	}
 
-	return New(&NodeMap{m: m}), nil
+	m[templateName(options, fn)] = n
+	return nil
 }
 
-func stripExt(filename string) string {
-	a := 0
-	if r := strings.LastIndex(filename, "/"); r > -1 {
-		a = r + 1
+// templateName returns the name of the template in file fn.
+func templateName(options *Options, fn string) string {
+	if options.StripExtension {
+		return tmplfile.StripExtension(fn)
 	}
+	return fn
+}
 
-	if b := strings.IndexRune(filename[a:], '.'); b > -1 {
-		return filename[:a+b]
-	} else {
-		return filename
+// globFS returns the names of all files in fsys that match one of the
+// patterns, in lexical order. Every pattern must match at least one file.
+func globFS(fsys fs.FS, patterns []string) ([]string, error) {
+	filenames, matched, err := matchFS(fsys, patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, pattern := range patterns {
+		if !matched[i] {
+			return nil, fmt.Errorf("template: pattern matches no files: %#q", pattern)
+		}
+	}
+
+	return filenames, nil
+}
+
+// matchFS returns the names of all files in fsys that match one of the
+// patterns, in lexical order, and which of the patterns matched a file.
+func matchFS(fsys fs.FS, patterns []string) (filenames []string, matched []bool, err error) {
+	for _, pattern := range patterns {
+		// Check the syntax of each element of the pattern.
+		for _, elem := range strings.Split(pattern, "/") {
+			if _, err := path.Match(elem, ""); err != nil {
+				return nil, nil, fmt.Errorf("template: bad pattern %#q: %v", pattern, err)
+			}
+		}
 	}
+
+	matched = make([]bool, len(patterns))
+
+	err = fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		found := false
+		for i, pattern := range patterns {
+			if matchPath(strings.Split(pattern, "/"), strings.Split(name, "/")) {
+				matched[i] = true
+				found = true
+			}
+		}
+
+		if found {
+			filenames = append(filenames, name)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return filenames, matched, nil
+}
+
+// matchPath reports whether the elements of a path match the elements of
+// a pattern. A "**" element matches zero or more elements of the path.
+func matchPath(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchPath(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return len(name) == 0
 }
@@ -1,19 +1,121 @@
 package template
 
-import "testing"
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
 
-func TestStripExt(t *testing.T) {
-	tests := [][]string{
-		{"abc.ext", "abc"},
-		{"abc.tar.gz", "abc"},
-		{"a.b.c/abc.tar.gz", "a.b.c/abc"},
-		{"a.b.c/.", "a.b.c/"},
-		{"a.b.c/", "a.b.c/"},
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		match         bool
+	}{
+		{"*.html", "a.html", true},
+		{"*.html", "a/b.html", false},
+		{"**/*.html", "a.html", true},
+		{"**/*.html", "a/b/c.html", true},
+		{"a/**", "a/b/c.html", true},
+		{"a/**/c.html", "a/c.html", true},
+		{"a/**/c.html", "b/c.html", false},
+		{"a/?.txt", "a/b.txt", true},
 	}
 
 	for _, test := range tests {
-		if r := stripExt(test[0]); r != test[1] {
-			t.Errorf("got\n\t%+v\nexpected\n\t%v", r, test[1])
+		if r := matchPath(strings.Split(test.pattern, "/"), strings.Split(test.name, "/")); r != test.match {
+			t.Errorf("%q, %q: got %t, expected %t", test.pattern, test.name, r, test.match)
 		}
 	}
 }
+
+func TestParseFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"page.html":          {Data: []byte("((>partials/user))")},
+		"partials/user.html": {Data: []byte("((Name))")},
+		"partials/user.txt":  {Data: []byte("txt")},
+	}
+
+	tmpl, err := ParseFS(&Options{StripExtension: true}, fsys, "**/*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, "page", map[string]string{"Name": "Ann"}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "Ann" {
+		t.Errorf("got %q", buf.String())
+	}
+
+	if _, err := ParseFS(nil, fsys, "*.html", "*.md"); err == nil || err.Error() != "template: pattern matches no files: `*.md`" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if _, err := ParseFS(nil, fsys, "[*.html"); err == nil {
+		t.Error("expected error; got none")
+	}
+}
+
+type swapData struct {
+	nodes *NodeMap
+}
+
+// Swap replaces the template "part" in the middle of an execution.
+func (d swapData) Swap() string {
+	n, _ := Parse("part", "", "", "new")
+	d.nodes.Set("part", n)
+	return ""
+}
+
+func TestNodeMapSnapshot(t *testing.T) {
+	tmpl := parseTemplates(t, map[string]string{
+		"page": "((>part))((Swap))((>part))",
+		"part": "old",
+	})
+	nodes := tmpl.nodes.(*NodeMap)
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, "page", swapData{nodes}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "oldold" {
+		t.Errorf("got %q, expected a single snapshot", buf.String())
+	}
+
+	buf.Reset()
+	if err := tmpl.Execute(&buf, "page", swapData{nodes}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "newnew" {
+		t.Errorf("got %q", buf.String())
+	}
+}
+
+func BenchmarkNodeMapGetParallel(b *testing.B) {
+	nodes := NewNodeMap(map[string]Node{"a": newList(0)})
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			nodes.Get("a")
+		}
+	})
+}
+
+func BenchmarkExecuteParallel(b *testing.B) {
+	tmpl := parseTemplates(b, map[string]string{
+		"page": "((#Users))((>user))((/Users))",
+		"user": "<((Name))>",
+	})
+
+	b.RunParallel(func(pb *testing.PB) {
+		var buf bytes.Buffer
+		for pb.Next() {
+			buf.Reset()
+			if err := tmpl.Execute(&buf, "page", execTestData); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,66 @@
+// Package tmplfile finds and names template files for ParseFiles
+// and the commands.
+package tmplfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// StripExtension removes everything from the first dot in the last
+// element of name, e.g. "users/list.tmpl.html" becomes "users/list".
+func StripExtension(name string) string {
+	a := strings.LastIndex(name, "/") + 1
+	if b := strings.IndexRune(name[a:], '.'); b > -1 {
+		return name[:a+b]
+	}
+	return name
+}
+
+// IsTemplate reports whether a file with the base name name is a
+// template file, which means that it has one of the extensions.
+// Hidden files are never template files.
+func IsTemplate(name string, extensions []string) bool {
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+
+	for _, ext := range extensions {
+		if ext != "" && strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Find returns the paths, relative to dir, of all template files in dir
+// and its subdirectories, in lexical order. Hidden directories are skipped.
+func Find(dir string, extensions []string) ([]string, error) {
+	var filenames []string
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		switch {
+		case err != nil:
+			return err
+		case info.IsDir():
+			if strings.HasPrefix(info.Name(), ".") && path != dir {
+				return filepath.SkipDir
+			}
+			return nil
+		case !IsTemplate(info.Name(), extensions):
+			return nil
+		}
+
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		filenames = append(filenames, name)
+		return nil
+	})
+
+	return filenames, err
+}
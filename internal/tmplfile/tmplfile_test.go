@@ -0,0 +1,70 @@
+package tmplfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStripExtension(t *testing.T) {
+	tests := [][]string{
+		{"abc.ext", "abc"},
+		{"abc.tar.gz", "abc"},
+		{"a.b.c/abc.tar.gz", "a.b.c/abc"},
+		{"a.b.c/.", "a.b.c/"},
+		{"a.b.c/", "a.b.c/"},
+	}
+
+	for _, test := range tests {
+		if r := StripExtension(test[0]); r != test[1] {
+			t.Errorf("got\n\t%+v\nexpected\n\t%v", r, test[1])
+		}
+	}
+}
+
+func TestIsTemplate(t *testing.T) {
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"index.tmpl", true},
+		{"index.html", true},
+		{".index.tmpl", false},
+		{"index.tmpl.bak", false},
+		{"index", false},
+	}
+
+	for _, test := range tests {
+		if ok := IsTemplate(test.name, []string{".tmpl", ".html", ""}); ok != test.ok {
+			t.Errorf("%s: got %t, expected %t", test.name, ok, test.ok)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tmplfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"b.tmpl", "a/c.html", "a/.d.tmpl", ".git/e.tmpl", "f.txt"} {
+		fn := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fn, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	filenames, err := Find(dir, []string{".tmpl", ".html"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{filepath.Join("a", "c.html"), "b.tmpl"}; !reflect.DeepEqual(filenames, expected) {
+		t.Errorf("got %q, expected %q", filenames, expected)
+	}
+}
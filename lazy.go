@@ -0,0 +1,168 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+)
+
+// Loader loads the source of a template by name.
+type Loader interface {
+	Load(name string) (source string, err error)
+}
+
+// LoaderFunc is an adapter to allow the use of an ordinary
+// function as a Loader.
+type LoaderFunc func(name string) (string, error)
+
+func (f LoaderFunc) Load(name string) (string, error) {
+	return f(name)
+}
+
+// FSLoader loads templates from a file system. The name
+// of a template is the path of its file.
+type FSLoader struct {
+	FS fs.FS
+}
+
+func (l FSLoader) Load(name string) (string, error) {
+	b, err := fs.ReadFile(l.FS, name)
+	return string(b), err
+}
+
+// LazyStorage is a NodeStorage that parses templates when they are first
+// requested. Parsed templates are cached. Concurrent requests for the
+// same template share a single load. A template that doesn't exist, which
+// the Loader reports with an error that matches fs.ErrNotExist, is
+// remembered as missing until it's Set, so that it isn't loaded again
+// every time an Overlay asks for it. Other failed loads are not cached.
+type LazyStorage struct {
+	mu      sync.RWMutex
+	m       map[string]Node
+	missing map[string]error
+	calls   map[string]*loadCall
+	options *Options
+	loader  Loader
+}
+
+// loadCall is a load that is in progress or completed. If the Loader
+// panics, the panic is passed on to every goroutine that waits for it.
+type loadCall struct {
+	wg       sync.WaitGroup
+	node     Node
+	err      error
+	panicked bool
+	value    interface{} // The value of the panic.
+}
+
+func NewLazyStorage(options *Options, loader Loader) *LazyStorage {
+	if options == nil {
+		options = &Options{}
+	}
+
+	return &LazyStorage{
+		m:       make(map[string]Node),
+		missing: make(map[string]error),
+		calls:   make(map[string]*loadCall),
+		options: options,
+		loader:  loader,
+	}
+}
+
+func (l *LazyStorage) Get(name string) (Node, bool) {
+	n, err := l.Load(name)
+	return n, err == nil
+}
+
+func (l *LazyStorage) Set(name string, n Node) {
+	l.mu.Lock()
+	l.m[name] = n
+	delete(l.missing, name)
+	l.mu.Unlock()
+}
+
+// Load returns the template name, loading and parsing it if it
+// isn't cached yet.
+func (l *LazyStorage) Load(name string) (Node, error) {
+	l.mu.RLock()
+	n, ok := l.m[name]
+	err := l.missing[name]
+	l.mu.RUnlock()
+
+	if ok || err != nil {
+		return n, err
+	}
+
+	l.mu.Lock()
+	if n, ok := l.m[name]; ok {
+		l.mu.Unlock()
+		return n, nil
+	}
+	if err := l.missing[name]; err != nil {
+		l.mu.Unlock()
+		return nil, err
+	}
+	if c, ok := l.calls[name]; ok {
+		l.mu.Unlock()
+		c.wg.Wait()
+		if c.panicked {
+			panic(c.value)
+		}
+		return c.node, c.err
+	}
+
+	c := new(loadCall)
+	c.wg.Add(1)
+	l.calls[name] = c
+	l.mu.Unlock()
+
+	l.call(c, name)
+
+	return c.node, c.err
+}
+
+// call runs the load c of the template name. The call is finished even
+// if the Loader panics, and the panic is passed on after that.
+func (l *LazyStorage) call(c *loadCall, name string) {
+	returned := false
+	defer func() {
+		if !returned {
+			if c.value = recover(); c.value != nil {
+				c.panicked = true
+			} else {
+				// The Loader called runtime.Goexit.
+				c.err = fmt.Errorf("template: loader of %s did not return", name)
+			}
+		}
+
+		l.mu.Lock()
+		switch {
+		case c.panicked:
+		case c.err == nil:
+			l.m[name] = c.node
+		case errors.Is(c.err, fs.ErrNotExist):
+			l.missing[name] = c.err
+		}
+		delete(l.calls, name)
+		l.mu.Unlock()
+
+		c.wg.Done()
+
+		if c.panicked {
+			panic(c.value)
+		}
+	}()
+
+	c.node, c.err = l.load(name)
+	returned = true
+}
+
+func (l *LazyStorage) load(name string) (Node, error) {
+	src, err := l.loader.Load(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseOptions(name, l.options, src)
+}
@@ -0,0 +1,170 @@
+package template
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestLazyStorage(t *testing.T) {
+	var loads int32
+	sources := map[string]string{
+		"page":   "((<layout))(($body))((>user))((/body))((/layout))",
+		"layout": "<(($body))((/body))>",
+		"user":   "((Name))",
+		"broken": "((#x))",
+	}
+
+	l := NewLazyStorage(nil, LoaderFunc(func(name string) (string, error) {
+		atomic.AddInt32(&loads, 1)
+		if src, ok := sources[name]; ok {
+			return src, nil
+		}
+		return "", errors.New("no such template")
+	}))
+
+	tmpl := New(l)
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, "page", map[string]string{"Name": "Ann"}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "<Ann>" {
+		t.Errorf("got %q", buf.String())
+	}
+	if loads != 3 {
+		t.Errorf("got %d loads, expected 3", loads)
+	}
+
+	// Cached.
+	tmpl.Execute(&buf, "page", nil)
+	if loads != 3 {
+		t.Errorf("got %d loads, expected 3", loads)
+	}
+
+	err := tmpl.Execute(&buf, "missing", nil)
+	if err == nil || err.Error() != "template not available: missing: no such template" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	err = tmpl.Execute(&buf, "broken", nil)
+	if err == nil || !strings.Contains(err.Error(), "broken:1: tag not closed") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestLazyStorageConcurrent(t *testing.T) {
+	const n = 10
+
+	var (
+		loads   int32
+		started sync.WaitGroup
+		wg      sync.WaitGroup
+	)
+	started.Add(n)
+
+	// The loader doesn't return before every goroutine is about to call
+	// Get, and then yields so that they reach it while the load runs.
+	l := NewLazyStorage(nil, LoaderFunc(func(name string) (string, error) {
+		atomic.AddInt32(&loads, 1)
+		started.Wait()
+		for i := 0; i < 100; i++ {
+			runtime.Gosched()
+		}
+		return "x", nil
+	}))
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			started.Done()
+			if _, ok := l.Get("a"); !ok {
+				t.Error("template not available")
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if loads := atomic.LoadInt32(&loads); loads != 1 {
+		t.Errorf("got %d loads, expected 1", loads)
+	}
+}
+
+func TestFSLoader(t *testing.T) {
+	l := NewLazyStorage(nil, FSLoader{fstest.MapFS{"a/b.html": {Data: []byte("b")}}})
+
+	if _, ok := l.Get("a/b.html"); !ok {
+		t.Error("template not available")
+	}
+}
+
+func TestLazyStoragePanic(t *testing.T) {
+	var fail int32 = 1
+	l := NewLazyStorage(nil, LoaderFunc(func(name string) (string, error) {
+		if atomic.LoadInt32(&fail) == 1 {
+			panic("loader failed")
+		}
+		return "x", nil
+	}))
+
+	func() {
+		defer func() {
+			if r := recover(); r != "loader failed" {
+				t.Errorf("got panic %v", r)
+			}
+		}()
+		l.Load("a")
+	}()
+
+	// The failed load doesn't block later loads.
+	atomic.StoreInt32(&fail, 0)
+	done := make(chan bool)
+	go func() {
+		_, ok := l.Get("a")
+		done <- ok
+	}()
+
+	select {
+	case ok := <-done:
+		if !ok {
+			t.Error("template not available")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Load blocked after a panic in the loader")
+	}
+}
+
+func TestLazyStorageMissing(t *testing.T) {
+	var loads int32
+	l := NewLazyStorage(nil, LoaderFunc(func(name string) (string, error) {
+		atomic.AddInt32(&loads, 1)
+		if name == "flaky" {
+			return "", errors.New("timeout")
+		}
+		return "", fs.ErrNotExist
+	}))
+
+	for i := 0; i < 3; i++ {
+		if _, err := l.Load("a"); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("got error %v", err)
+		}
+		l.Load("flaky")
+	}
+	if loads != 4 {
+		t.Errorf("got %d loads, expected 4", loads)
+	}
+
+	l.Set("a", newList(0))
+	if _, ok := l.Get("a"); !ok {
+		t.Error("template not available after Set")
+	}
+}
@@ -13,6 +13,7 @@ package template
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -74,6 +75,28 @@ func (i item) Type() string {
 		s = "itemComplex"
 	case itemNumber:
 		s = "itemNumber"
+	case itemIndent:
+		s = "itemIndent"
+	case itemAssign:
+		s = "itemAssign"
+	case itemOperator:
+		s = "itemOperator"
+	case itemLeftParen:
+		s = "itemLeftParen"
+	case itemRightParen:
+		s = "itemRightParen"
+	case itemLeftBracket:
+		s = "itemLeftBracket"
+	case itemRightBracket:
+		s = "itemRightBracket"
+	case itemLeftBrace:
+		s = "itemLeftBrace"
+	case itemRightBrace:
+		s = "itemRightBrace"
+	case itemComma:
+		s = "itemComma"
+	case itemColon:
+		s = "itemColon"
 	default:
 		s = "Unknown"
 	}
@@ -85,19 +108,30 @@ func (i item) Type() string {
 type itemType int
 
 const (
-	itemError      itemType = iota // Error occurred; value is text of error
-	itemEOF                        // End of file
-	itemLeftDelim                  // Left action delimiter
-	itemRightDelim                 // Right action delimiter
-	itemText                       // Plain text
-	itemTagType                    // Defines the type of a tag
-	itemIdentifier                 // Alphanumeric identifier
-	itemDot                        // A dot
-	itemName                       // A name
-	itemSpace                      // Run of spaces separating arguments
-	itemString                     // A text string
-	itemComplex                    // complex constant (1+2i); imaginary is just a number
-	itemNumber                     // simple number, including imaginary
+	itemError        itemType = iota // Error occurred; value is text of error
+	itemEOF                          // End of file
+	itemLeftDelim                    // Left action delimiter
+	itemRightDelim                   // Right action delimiter
+	itemText                         // Plain text
+	itemTagType                      // Defines the type of a tag
+	itemIdentifier                   // Alphanumeric identifier
+	itemDot                          // A dot
+	itemName                         // A name
+	itemSpace                        // Run of spaces separating arguments
+	itemString                       // A text string
+	itemComplex                      // complex constant (1+2i); imaginary is just a number
+	itemNumber                       // simple number, including imaginary
+	itemIndent                       // Indentation of a standalone Mustache partial
+	itemAssign                       // Equals sign of a key=value parameter
+	itemOperator                     // Operator, like == or &&
+	itemLeftParen                    // '(' inside an expression
+	itemRightParen                   // ')' inside an expression
+	itemLeftBracket                  // '[' that starts a list
+	itemRightBracket                 // ']' that ends a list
+	itemLeftBrace                    // '{' that starts a map
+	itemRightBrace                   // '}' that ends a map
+	itemComma                        // ',' between elements of a list or map
+	itemColon                        // ':' between a key and a value in a map
 )
 
 const eof = -1
@@ -117,6 +151,15 @@ type lexer struct {
 	width      Pos       // width of last rune read from input
 	lastPos    Pos       // position of most recent item returned by nextItem
 	items      chan item // channel of scanned items
+	kebab      bool      // allow hyphens in identifiers
+	depth      int       // nesting depth of parentheses, brackets and braces
+
+	// Mustache syntax.
+	mustache   bool
+	rawBrace   bool     // in a {{{ }}} tag
+	skipTo     Pos      // end of the line of a standalone tag
+	keepSpace  bool     // scan the whitespace around standalone tags as text
+	nextDelims []string // delimiters set by the current tag
 }
 
 // next returns the next rune in the input.
@@ -224,8 +267,11 @@ func (l *lexer) scanNumber() bool {
 	return true
 }
 
-// lex creates a new scanner for the input string.
-func lex(name, input, left, right string) *lexer {
+// lex creates a new scanner for the input string, with the delimiters
+// and syntax of options. If keepSpace is set, the whitespace around
+// standalone Mustache tags is scanned as text.
+func lex(name, input string, options *Options, keepSpace bool) *lexer {
+	left, right := options.LeftDelim, options.RightDelim
 	if left == "" {
 		left = leftDelim
 	}
@@ -238,6 +284,9 @@ func lex(name, input, left, right string) *lexer {
 		leftDelim:  left,
 		rightDelim: right,
 		items:      make(chan item),
+		mustache:   options.Mustache,
+		kebab:      options.KebabCase,
+		keepSpace:  keepSpace,
 	}
 	go l.run()
 	return l
@@ -258,14 +307,16 @@ const (
 )
 
 var (
-	lexSpaceExpr stateFn
-	lexSpaceName stateFn
+	lexSpaceExpr    stateFn
+	lexSpaceName    stateFn
+	lexSpacePartial stateFn
 )
 
 func init() {
 	// NOTE: Functions initialized here to avoid an initialization loop.
 	lexSpaceExpr = makeLexSpace(lexExpressionTag)
 	lexSpaceName = makeLexSpace(lexNameTag)
+	lexSpacePartial = makeLexSpace(lexPartialTag)
 }
 
 func makeLexSpace(nextState stateFn) stateFn {
@@ -282,6 +333,11 @@ func makeLexSpace(nextState stateFn) stateFn {
 func lexText(l *lexer) stateFn {
 	for {
 		if strings.HasPrefix(l.input[l.pos:], l.leftDelim) {
+			if l.mustache && !l.keepSpace {
+				if lineStart, lineEnd, ok := l.standalone(); ok {
+					return l.lexStandalone(lineStart, lineEnd)
+				}
+			}
 			if l.pos > l.start {
 				l.emit(itemText)
 			}
@@ -301,19 +357,127 @@ func lexText(l *lexer) stateFn {
 	return nil
 }
 
+// standalone reports whether the Mustache tag at the current position is
+// on a standalone line: a line with only whitespace and tags that don't
+// render anything, like sections and comments. It returns the start of
+// the line and, if the tag is the last one on the line, the position
+// after its end.
+func (l *lexer) standalone() (lineStart, lineEnd Pos, ok bool) {
+	start := strings.LastIndexByte(l.input[:l.pos], '\n') + 1
+	pos, last, tags, delims := start, -1, 0, false
+
+	for {
+		pos += len(l.input[pos:]) - len(strings.TrimLeft(l.input[pos:], " \t"))
+		if !strings.HasPrefix(l.input[pos:], l.leftDelim) {
+			break
+		}
+
+		rest := l.input[pos+len(l.leftDelim):]
+		if rest == "" || !strings.ContainsRune("#^/!<>$=", rune(rest[0])) {
+			return 0, 0, false
+		}
+
+		closing := l.rightDelim
+		if rest[0] == '=' {
+			closing = "=" + l.rightDelim
+			delims = true
+		}
+
+		i := strings.Index(rest[1:], closing)
+		if i < 0 {
+			return 0, 0, false
+		}
+
+		last = pos
+		tags++
+		pos += len(l.leftDelim) + 1 + i + len(closing)
+	}
+
+	// The delimiters of the tags after a set delimiter tag are not known.
+	if last < int(l.pos) || delims && tags > 1 {
+		return 0, 0, false
+	}
+
+	line := l.input[pos:]
+	if n := strings.IndexByte(line, '\n'); n >= 0 {
+		line = line[:n+1]
+	}
+	if strings.Trim(line, "\r\n") != "" {
+		return 0, 0, false
+	}
+
+	if last == int(l.pos) {
+		lineEnd = Pos(pos + len(line))
+	}
+
+	return Pos(start), lineEnd, true
+}
+
+// lexStandalone scans a tag on a standalone line. The whitespace around
+// the tags and the end of the line are removed, except that the
+// indentation of a partial is kept as its own item.
+func (l *lexer) lexStandalone(lineStart, lineEnd Pos) stateFn {
+	tag := l.pos
+
+	if lineStart >= l.start {
+		// The first tag on the line.
+		if lineStart > l.start {
+			l.pos = lineStart
+			l.emit(itemText)
+		}
+
+		l.pos = tag
+		if l.input[int(tag)+len(l.leftDelim)] == '>' && l.pos > l.start {
+			l.emit(itemIndent)
+		}
+	}
+
+	l.pos = tag
+	l.ignore()
+	l.skipTo = lineEnd
+
+	return lexLeftDelim
+}
+
 func lexLeftDelim(l *lexer) stateFn {
 	l.pos += Pos(len(l.leftDelim))
 	l.emit(itemLeftDelim)
+	l.depth = 0
 
 	return lexTag
 }
 
 func lexRightDelim(l *lexer) stateFn {
+	if l.rawBrace {
+		l.pos++
+		l.rawBrace = false
+	}
+
 	l.pos += Pos(len(l.rightDelim))
 	l.emit(itemRightDelim)
+
+	if l.skipTo > 0 {
+		l.pos = l.skipTo
+		l.skipTo = 0
+		l.ignore()
+	}
+	if l.nextDelims != nil {
+		l.leftDelim, l.rightDelim = l.nextDelims[0], l.nextDelims[1]
+		l.nextDelims = nil
+	}
+
 	return lexText
 }
 
+// rightDelimAhead reports whether the tag is closed at the current
+// position, which for {{{ }}} tags includes the closing brace.
+func (l *lexer) rightDelimAhead() bool {
+	if l.rawBrace {
+		return strings.HasPrefix(l.input[l.pos:], "}"+l.rightDelim)
+	}
+	return strings.HasPrefix(l.input[l.pos:], l.rightDelim)
+}
+
 func lexTag(l *lexer) stateFn {
 	r := l.next()
 
@@ -321,12 +485,28 @@ func lexTag(l *lexer) stateFn {
 	case '#', '^':
 		l.emit(itemTagType)
 		return lexExpressionTag
-	case '<', '>', '/', '$':
+	case '>':
+		l.emit(itemTagType)
+		return lexPartialTag
+	case '<', '/', '$':
 		l.emit(itemTagType)
 		return lexNameTag
 	case '!':
 		l.emit(itemTagType)
 		return lexComment
+	case '{', '&', '=':
+		if !l.mustache {
+			break
+		}
+
+		l.emit(itemTagType)
+		switch r {
+		case '{':
+			l.rawBrace = true
+		case '=':
+			return lexSetDelims
+		}
+		return lexExpressionTag
 	}
 
 	// Possibly a normal variable.
@@ -355,6 +535,28 @@ func lexComment(l *lexer) stateFn {
 	return lexRightDelim
 }
 
+// lexSetDelims scans the new delimiters of a Mustache
+// set delimiter tag, e.g. {{=<% %>=}}.
+func lexSetDelims(l *lexer) stateFn {
+	end := strings.Index(l.input[l.pos:], "="+l.rightDelim)
+	if end < 0 {
+		return l.errorf("unclosed tag")
+	}
+
+	delims := strings.Fields(l.input[l.pos : int(l.pos)+end])
+	if len(delims) != 2 || strings.Contains(delims[0]+delims[1], "=") {
+		return l.errorf("invalid delimiters: %q", l.input[l.pos:int(l.pos)+end])
+	}
+
+	l.pos += Pos(end)
+	l.emit(itemString)
+	l.pos++
+	l.ignore()
+	l.nextDelims = delims
+
+	return lexRightDelim
+}
+
 func lexExpressionTag(l *lexer) stateFn {
 	// NOTE: An expression tag (except variable tags) should always start
 	// with an identifier, not a string or number (both not implemented yet),
@@ -366,7 +568,10 @@ func lexExpressionTag(l *lexer) stateFn {
 	// easier to just use an indentifier. A closing tag will be handled
 	// as a identifier tag (lexIdentifierTag).
 
-	if strings.HasPrefix(l.input[l.pos:], l.rightDelim) {
+	// Inside parentheses a ) never starts the right delimiter, so
+	// that ((#(a || b))) can be written with the default delimiters.
+	// The same goes for braces of maps in {{ }} tags.
+	if l.depth == 0 && l.rightDelimAhead() {
 		return lexRightDelim
 	}
 
@@ -377,26 +582,114 @@ func lexExpressionTag(l *lexer) stateFn {
 		return l.errorf("unclosed tag")
 	case isSpace(r):
 		return lexSpaceExpr
+	case strings.ContainsRune("([{", r):
+		l.depth++
+		l.emit(brackets[r])
+		return lexExpressionTag
+	case r == ')', l.depth > 0 && strings.ContainsRune("]}", r):
+		l.depth--
+		l.emit(brackets[r])
+		return lexExpressionTag
+	case r == '#' || r == '^':
+		// The section of a chained else tag, like ((else #b)).
+		l.emit(itemTagType)
+		return lexExpressionTag
+	case r == ',':
+		l.emit(itemComma)
+		return lexExpressionTag
+	case r == ':':
+		l.emit(itemColon)
+		return lexExpressionTag
 	case isAlpha(r):
 		l.backup()
 		return lexIdentifier
-	case isNumeric(r), r == '-', r == '+':
+	case r == '@' && isAlpha(l.peek()):
+		// A variable like @index. The @ is part of the identifier.
+		return lexIdentifier
+	case r == '.' && l.peek() == '.':
+		return lexParent
+	case r == '.' && !isAlphaNumeric(l.peek()):
+		// The implicit iterator, i.e. the current context.
+		l.emit(itemIdentifier)
+		return lexExpressionTag
+	case isNumeric(r), (r == '-' || r == '+') && isNumeric(l.peek()) && !l.afterOperand():
 		l.backup()
 		return lexNumber
 	case r == '"':
-		l.ignore()
 		return lexString
+	case r == '`':
+		return lexRawString
+	case strings.ContainsRune("=!<>&|?+-*/%", r):
+		l.backup()
+		return lexOperator
 	}
 
 	return l.errorf("unrecognized character in tag: %#U", r)
 }
 
+// afterOperand reports whether the item that starts at the current
+// position directly follows an operand, like the 1 in a-1. A sign there
+// is an operator and not part of a number, so a-1 is a subtraction and
+// f -1 is a call with a negative number.
+func (l *lexer) afterOperand() bool {
+	if l.start == 0 {
+		return false
+	}
+
+	r, _ := utf8.DecodeLastRuneInString(l.input[:l.start])
+	return isAlphaNumeric(r) || strings.ContainsRune(".)]}\"`", r)
+}
+
+// brackets holds the item types of parentheses, brackets and braces.
+var brackets = map[rune]itemType{
+	'(': itemLeftParen,
+	')': itemRightParen,
+	'[': itemLeftBracket,
+	']': itemRightBracket,
+	'{': itemLeftBrace,
+	'}': itemRightBrace,
+}
+
+// operators holds the operators of expressions, longest first.
+var operators = []string{
+	"==", "!=", "<=", ">=", "&&", "||", "??",
+	"!", "<", ">", "+", "-", "*", "/", "%",
+}
+
+// lexOperator scans an operator. A single = is emitted as the
+// assignment of a parameter.
+func lexOperator(l *lexer) stateFn {
+	for _, op := range operators {
+		if strings.HasPrefix(l.input[l.pos:], op) {
+			l.pos += Pos(len(op))
+			l.emit(itemOperator)
+			return lexExpressionTag
+		}
+	}
+
+	if r := l.next(); r != '=' {
+		return l.errorf("unrecognized character in tag: %#U", r)
+	}
+	l.emit(itemAssign)
+
+	return lexExpressionTag
+}
+
 func lexIdentifier(l *lexer) stateFn {
 Loop:
 	for {
 		switch r := l.peek(); {
 		case isAlphaNumeric(r):
 			l.next()
+		case r == '-' && l.kebab && l.pos > l.start:
+			l.next()
+
+			if s := l.peek(); !isAlphaNumeric(s) {
+				return l.errorf("unrecognized character in identifier: %#U", r)
+			}
+		case r == '[':
+			l.emit(itemIdentifier)
+			return lexIndex
 		case r == '.':
 			l.emit(itemIdentifier)
 			l.next()
@@ -414,6 +707,92 @@ Loop:
 	return lexExpressionTag
 }
 
+// lexParent scans a reference to a parent context, like .. or
+// ../../title. The first dot has been read. Each .. is emitted as an
+// identifier and the slashes are dropped.
+func lexParent(l *lexer) stateFn {
+	for {
+		l.next()
+		l.emit(itemIdentifier)
+
+		if l.peek() != '/' || l.rightDelimAhead() {
+			if r := l.peek(); isAlphaNumeric(r) || r == '.' {
+				return l.errorf("unrecognized character in identifier: %#U", r)
+			}
+			return lexExpressionTag
+		}
+
+		l.next()
+		l.ignore()
+
+		switch r := l.next(); {
+		case isAlpha(r):
+			l.backup()
+			return lexIdentifier
+		case r != '.' || l.peek() != '.':
+			return l.errorf("unrecognized character in identifier: %#U", r)
+		}
+	}
+}
+
+// lexIndex scans an index like [0], [-1] or ["Content-Type"] after an
+// identifier. It's emitted as an identifier, with the brackets.
+func lexIndex(l *lexer) stateFn {
+	l.next()
+
+	switch r := l.next(); {
+	case r == '"':
+		if !l.scanQuoted() {
+			return l.errorf("unterminated quoted string")
+		}
+		if p := l.badEscape(l.start + 1); p >= 0 {
+			return l.escapeError(p)
+		}
+	case r == '-' && isNumeric(l.peek()), isNumeric(r):
+		l.acceptRun("0123456789")
+	default:
+		return l.errorf("unrecognized character in index: %#U", r)
+	}
+
+	if !l.accept("]") {
+		return l.errorf("unclosed index")
+	}
+	l.emit(itemIdentifier)
+
+	switch l.peek() {
+	case '[':
+		return lexIndex
+	case '.':
+		l.next()
+		l.emit(itemDot)
+
+		if r := l.peek(); !isAlphaNumeric(r) {
+			return l.errorf("unrecognized character in identifier: %#U", r)
+		}
+		return lexIdentifier
+	}
+
+	return lexExpressionTag
+}
+
+// scanQuoted scans the rest of a quoted string, after the opening
+// quote. It reports whether the string is terminated.
+func (l *lexer) scanQuoted() bool {
+	for {
+		switch l.next() {
+		case '\\':
+			if r := l.next(); r != eof && r != '\n' {
+				break
+			}
+			fallthrough
+		case eof, '\n':
+			return false
+		case '"':
+			return true
+		}
+	}
+}
+
 func lexNumber(l *lexer) stateFn {
 	if !l.scanNumber() {
 		return l.errorf("bad number syntax: %q", l.input[l.start:l.pos])
@@ -433,32 +812,60 @@ func lexNumber(l *lexer) stateFn {
 	return lexExpressionTag
 }
 
+// lexString scans a quoted string. The opening quote has been read.
+// It's emitted with its quotes and unquoted by the parser.
 func lexString(l *lexer) stateFn {
-Loop:
-	for {
-		switch l.next() {
-		case '\\':
-			if r := l.next(); r != eof && r != '\n' {
-				break
-			}
-			fallthrough
-		case eof, '\n':
-			return l.errorf("unterminated quoted string")
-		case '"':
-			break Loop
-		}
+	if !l.scanQuoted() {
+		return l.errorf("unterminated quoted string")
+	}
+	if p := l.badEscape(l.start); p >= 0 {
+		return l.escapeError(p)
 	}
+	l.emit(itemString)
 
-	// This might look a bit weird, but we don't want to have
-	// the quote in the string.
-	l.backup()
+	return lexExpressionTag
+}
+
+// lexRawString scans a raw string between backquotes, which may span
+// lines. The opening backquote has been read.
+func lexRawString(l *lexer) stateFn {
+	i := strings.IndexByte(l.input[l.pos:], '`')
+	if i < 0 {
+		return l.errorf("unterminated raw quoted string")
+	}
+	l.pos += Pos(i + 1)
 	l.emit(itemString)
-	l.next()
-	l.ignore()
 
 	return lexExpressionTag
 }
 
+// badEscape returns the position of the first invalid escape sequence
+// in the quoted string from start to the current position, or -1 if
+// all escape sequences are valid.
+func (l *lexer) badEscape(start Pos) Pos {
+	s := l.input[start+1 : l.pos-1]
+	for len(s) > 0 {
+		_, _, tail, err := strconv.UnquoteChar(s, '"')
+		if err != nil {
+			return l.pos - 1 - Pos(len(s))
+		}
+		s = tail
+	}
+
+	return -1
+}
+
+// escapeError reports the invalid escape sequence at pos.
+func (l *lexer) escapeError(pos Pos) stateFn {
+	_, col := lineCol(l.input, pos)
+	esc := l.input[pos:]
+	if _, size := utf8.DecodeRuneInString(esc[1:]); len(esc) > 1 {
+		esc = esc[:1+size]
+	}
+
+	return l.errorf("invalid escape sequence %s at column %d", esc, col)
+}
+
 func lexNameTag(l *lexer) stateFn {
 	if strings.HasPrefix(l.input[l.pos:], l.rightDelim) {
 		return lexRightDelim
@@ -471,7 +878,7 @@ func lexNameTag(l *lexer) stateFn {
 		return l.errorf("unclosed tag")
 	case isSpace(r):
 		return lexSpaceName
-	case isAlpha(r):
+	case isAlpha(r), r == '.', r == '@':
 		l.backup()
 		return lexName
 	}
@@ -479,14 +886,46 @@ func lexNameTag(l *lexer) stateFn {
 	return l.errorf("unrecognized character in tag: %#U", r)
 }
 
+// lexPartialTag scans the name of a partial, or a * and an identifier
+// for a dynamic partial. The arguments that follow are scanned like an
+// expression.
+func lexPartialTag(l *lexer) stateFn {
+	switch r := l.peek(); {
+	case isSpace(r):
+		return lexSpacePartial
+	case r == '*':
+		l.next()
+		l.emit(itemTagType)
+		return lexExpressionTag
+	case isAlpha(r), r == '.', r == '@':
+		return l.scanName(lexExpressionTag)
+	}
+
+	return lexNameTag
+}
+
 func lexName(l *lexer) stateFn {
-	if r := l.next(); !isAlpha(r) {
-		return l.errorf("name must begin with a letter, but got: %#U", r)
+	return l.scanName(lexNameTag)
+}
+
+// scanName scans a name and continues with next.
+func (l *lexer) scanName(next stateFn) stateFn {
+	// Names that begin with a dot are relative (e.g. ./name or ../name).
+	// Sections of variables like @first are closed with their name.
+	if r := l.next(); !isAlpha(r) && r != '.' && r != '@' {
+		return l.errorf("name must begin with a letter, a dot or an @, but got: %#U", r)
 	}
 
 	for {
 		r := l.next()
-		if !isAlphaNumeric(r) && r != '.' && r != '/' {
+		if r == '"' {
+			// A quoted key of a path, like a["b c"].
+			if !l.scanQuoted() {
+				return l.errorf("unterminated quoted string")
+			}
+			continue
+		}
+		if !isAlphaNumeric(r) && !strings.ContainsRune("./-[]", r) {
 			break
 		}
 	}
@@ -494,7 +933,7 @@ func lexName(l *lexer) stateFn {
 	l.backup()
 	l.emit(itemName)
 
-	return lexNameTag
+	return next
 }
 
 func isAlpha(r rune) bool {
@@ -76,6 +76,14 @@ var lexTests = []lexTest{
 		tRight,
 		tEOF,
 	}},
+	{"relative-name", "((> ../a/./b))", []item{
+		tLeft,
+		{itemTagType, 0, ">"},
+		tSpace,
+		{itemName, 0, "../a/./b"},
+		tRight,
+		tEOF,
+	}},
 	{"numbers", "((1 02 0x14 -7.2i 1e3 +1.2e-4 4.2i 1+2i))", []item{
 		tLeft,
 		{itemNumber, 0, "1"},
@@ -96,18 +104,206 @@ var lexTests = []lexTest{
 		tRight,
 		tEOF,
 	}},
+	{"signs", "((-1 a -1 a-1 [-7.2i, +2] (-3) == -4))", []item{
+		tLeft,
+		{itemNumber, 0, "-1"},
+		tSpace,
+		{itemIdentifier, 0, "a"},
+		tSpace,
+		{itemNumber, 0, "-1"},
+		tSpace,
+		{itemIdentifier, 0, "a"},
+		{itemOperator, 0, "-"},
+		{itemNumber, 0, "1"},
+		tSpace,
+		{itemLeftBracket, 0, "["},
+		{itemNumber, 0, "-7.2i"},
+		{itemComma, 0, ","},
+		tSpace,
+		{itemNumber, 0, "+2"},
+		{itemRightBracket, 0, "]"},
+		tSpace,
+		{itemLeftParen, 0, "("},
+		{itemNumber, 0, "-3"},
+		{itemRightParen, 0, ")"},
+		tSpace,
+		{itemOperator, 0, "=="},
+		tSpace,
+		{itemNumber, 0, "-4"},
+		tRight,
+		tEOF,
+	}},
+	{"negation", "((#!a && !b))((!))((!\tc))((!note))", []item{
+		tLeft,
+		{itemTagType, 0, "#"},
+		{itemOperator, 0, "!"},
+		{itemIdentifier, 0, "a"},
+		tSpace,
+		{itemOperator, 0, "&&"},
+		tSpace,
+		{itemOperator, 0, "!"},
+		{itemIdentifier, 0, "b"},
+		tRight,
+		tLeft,
+		{itemTagType, 0, "!"},
+		{itemString, 0, ""},
+		tRight,
+		tLeft,
+		{itemTagType, 0, "!"},
+		{itemString, 0, "\tc"},
+		tRight,
+		tLeft,
+		{itemTagType, 0, "!"},
+		{itemString, 0, "note"},
+		tRight,
+		tEOF,
+	}},
+	{"variable-at", "((#@first))", []item{
+		tLeft,
+		{itemTagType, 0, "#"},
+		{itemIdentifier, 0, "@first"},
+		tRight,
+		tEOF,
+	}},
+	{"parent", "((../../a.b ..))", []item{
+		tLeft,
+		{itemIdentifier, 0, ".."},
+		{itemIdentifier, 0, ".."},
+		{itemIdentifier, 0, "a"},
+		tDot,
+		{itemIdentifier, 0, "b"},
+		tSpace,
+		{itemIdentifier, 0, ".."},
+		tRight,
+		tEOF,
+	}},
+	{"parent-without-name", "((../))", []item{
+		tLeft,
+		{itemIdentifier, 0, ".."},
+		{itemError, 0, "unrecognized character in identifier: U+0029 ')'"},
+	}},
+	{"index", `((a[0].b["c \"d\""][-1]))`, []item{
+		tLeft,
+		{itemIdentifier, 0, "a"},
+		{itemIdentifier, 0, "[0]"},
+		tDot,
+		{itemIdentifier, 0, "b"},
+		{itemIdentifier, 0, `["c \"d\""]`},
+		{itemIdentifier, 0, "[-1]"},
+		tRight,
+		tEOF,
+	}},
+	{"bad-index", "((a[b]))", []item{
+		tLeft,
+		{itemIdentifier, 0, "a"},
+		{itemError, 0, "unrecognized character in index: U+0062 'b'"},
+	}},
+	{"unclosed-index", "((a[0))", []item{
+		tLeft,
+		{itemIdentifier, 0, "a"},
+		{itemError, 0, "unclosed index"},
+	}},
 	{"strings", `((variable "and a \"string\""))`, []item{
 		tLeft,
 		{itemIdentifier, 0, "variable"},
 		tSpace,
-		{itemString, 0, `and a \"string\"`},
+		{itemString, 0, `"and a \"string\""`},
 		tRight,
 		tEOF,
 	}},
+	{"raw-string", "((a `b\\n\n\"c\"`))", []item{
+		tLeft,
+		{itemIdentifier, 0, "a"},
+		tSpace,
+		{itemString, 0, "`b\\n\n\"c\"`"},
+		tRight,
+		tEOF,
+	}},
+	{"unterminated-raw-string", "((a `b))", []item{
+		tLeft,
+		{itemIdentifier, 0, "a"},
+		tSpace,
+		{itemError, 0, "unterminated raw quoted string"},
+	}},
+	{"bad-escape", "((a \"b\\qc\"))", []item{
+		tLeft,
+		{itemIdentifier, 0, "a"},
+		tSpace,
+		{itemError, 0, "invalid escape sequence \\q at column 7"},
+	}},
+	{"bad-escape-index", "x\n((a[\"\\x1\"]))", []item{
+		{itemText, 0, "x\n"},
+		tLeft,
+		{itemIdentifier, 0, "a"},
+		{itemError, 0, "invalid escape sequence \\x at column 6"},
+	}},
+	{"operators", "((#a>=1&&!b ?? c-1))", []item{
+		tLeft,
+		{itemTagType, 0, "#"},
+		{itemIdentifier, 0, "a"},
+		{itemOperator, 0, ">="},
+		{itemNumber, 0, "1"},
+		{itemOperator, 0, "&&"},
+		{itemOperator, 0, "!"},
+		{itemIdentifier, 0, "b"},
+		tSpace,
+		{itemOperator, 0, "??"},
+		tSpace,
+		{itemIdentifier, 0, "c"},
+		{itemOperator, 0, "-"},
+		{itemNumber, 0, "1"},
+		tRight,
+		tEOF,
+	}},
+	{"literals", "((f [1,{a: b}]))", []item{
+		tLeft,
+		{itemIdentifier, 0, "f"},
+		tSpace,
+		{itemLeftBracket, 0, "["},
+		{itemNumber, 0, "1"},
+		{itemComma, 0, ","},
+		{itemLeftBrace, 0, "{"},
+		{itemIdentifier, 0, "a"},
+		{itemColon, 0, ":"},
+		tSpace,
+		{itemIdentifier, 0, "b"},
+		{itemRightBrace, 0, "}"},
+		{itemRightBracket, 0, "]"},
+		tRight,
+		tEOF,
+	}},
+	{"else-chained", "((else #a))", []item{
+		tLeft,
+		{itemIdentifier, 0, "else"},
+		tSpace,
+		{itemTagType, 0, "#"},
+		{itemIdentifier, 0, "a"},
+		tRight,
+		tEOF,
+	}},
+	{"parentheses", "((#(a || b)))", []item{
+		tLeft,
+		{itemTagType, 0, "#"},
+		{itemLeftParen, 0, "("},
+		{itemIdentifier, 0, "a"},
+		tSpace,
+		{itemOperator, 0, "||"},
+		tSpace,
+		{itemIdentifier, 0, "b"},
+		{itemRightParen, 0, ")"},
+		tRight,
+		tEOF,
+	}},
+	{"single-ampersand", "((a & b))", []item{
+		tLeft,
+		{itemIdentifier, 0, "a"},
+		tSpace,
+		{itemError, 0, "unrecognized character in tag: U+0026 '&'"},
+	}},
 }
 
-func collect(t *lexTest, left, right string) (items []item) {
-	l := lex(t.name, t.input, left, right)
+func collect(t *lexTest, options *Options) (items []item) {
+	l := lex(t.name, t.input, options, false)
 
 	for {
 		item := l.nextItem()
@@ -140,7 +336,7 @@ func equal(i1, i2 []item, checkPos bool) bool {
 
 func TestLex(t *testing.T) {
 	for _, test := range lexTests {
-		items := collect(&test, "", "")
+		items := collect(&test, &Options{})
 		if !equal(items, test.items, false) {
 			t.Errorf("%s: got\n\t%+v\nexpected\n\t%v", test.name, items, test.items)
 		}
@@ -164,7 +360,152 @@ var lexDelimTests = []lexTest{
 
 func TestDelims(t *testing.T) {
 	for _, test := range lexDelimTests {
-		items := collect(&test, "$$", "@@")
+		items := collect(&test, &Options{LeftDelim: "$$", RightDelim: "@@"})
+		if !equal(items, test.items, false) {
+			t.Errorf("%s: got\n\t%v\nexpected\n\t%v", test.name, items, test.items)
+		}
+	}
+}
+
+var lexKebabTests = []lexTest{
+	{"kebab", "((created-at a.b-c-d -1))", []item{
+		tLeft,
+		{itemIdentifier, 0, "created-at"},
+		tSpace,
+		{itemIdentifier, 0, "a"},
+		tDot,
+		{itemIdentifier, 0, "b-c-d"},
+		tSpace,
+		{itemNumber, 0, "-1"},
+		tRight,
+		tEOF,
+	}},
+	{"trailing-hyphen", "((a-))", []item{
+		tLeft,
+		{itemError, 0, "unrecognized character in identifier: U+002D '-'"},
+	}},
+}
+
+func TestLexKebabCase(t *testing.T) {
+	for _, test := range lexKebabTests {
+		items := collect(&test, &Options{KebabCase: true})
+		if !equal(items, test.items, false) {
+			t.Errorf("%s: got\n\t%v\nexpected\n\t%v", test.name, items, test.items)
+		}
+	}
+}
+
+var (
+	tMLeft  = item{itemLeftDelim, 0, "{{"}
+	tMRight = item{itemRightDelim, 0, "}}"}
+)
+
+var lexMustacheTests = []lexTest{
+	{"raw", "{{{a}}}{{&b}}", []item{
+		tMLeft,
+		{itemTagType, 0, "{"},
+		{itemIdentifier, 0, "a"},
+		{itemRightDelim, 0, "}}}"},
+		tMLeft,
+		{itemTagType, 0, "&"},
+		{itemIdentifier, 0, "b"},
+		tMRight,
+		tEOF,
+	}},
+	{"implicit-iterator", "{{.}}", []item{
+		tMLeft,
+		{itemIdentifier, 0, "."},
+		tMRight,
+		tEOF,
+	}},
+	{"set-delimiters", "{{=<% %>=}}<%a%>{{b}}", []item{
+		tMLeft,
+		{itemTagType, 0, "="},
+		{itemString, 0, "<% %>"},
+		tMRight,
+		{itemLeftDelim, 0, "<%"},
+		{itemIdentifier, 0, "a"},
+		{itemRightDelim, 0, "%>"},
+		{itemText, 0, "{{b}}"},
+		tEOF,
+	}},
+	{"standalone", "a\n  {{#b}}  \n  {{>c}}\n{{/b}}{{! d }}\r\nz", []item{
+		{itemText, 0, "a\n"},
+		tMLeft,
+		{itemTagType, 0, "#"},
+		{itemIdentifier, 0, "b"},
+		tMRight,
+		{itemIndent, 0, "  "},
+		tMLeft,
+		{itemTagType, 0, ">"},
+		{itemName, 0, "c"},
+		tMRight,
+		tMLeft,
+		{itemTagType, 0, "/"},
+		{itemName, 0, "b"},
+		tMRight,
+		tMLeft,
+		{itemTagType, 0, "!"},
+		{itemString, 0, " d "},
+		tMRight,
+		{itemText, 0, "z"},
+		tEOF,
+	}},
+	{"standalone-else", "{{#a}}\nx\n  {{^}}\ny\n{{/a}}", []item{
+		tMLeft,
+		{itemTagType, 0, "#"},
+		{itemIdentifier, 0, "a"},
+		tMRight,
+		{itemText, 0, "x\n"},
+		tMLeft,
+		{itemTagType, 0, "^"},
+		tMRight,
+		{itemText, 0, "y\n"},
+		tMLeft,
+		{itemTagType, 0, "/"},
+		{itemName, 0, "a"},
+		tMRight,
+		tEOF,
+	}},
+	{"keyword-not-standalone", "{{#a}}\nx\n  {{else}}\ny\n{{/a}}", []item{
+		tMLeft,
+		{itemTagType, 0, "#"},
+		{itemIdentifier, 0, "a"},
+		tMRight,
+		{itemText, 0, "x\n  "},
+		tMLeft,
+		{itemIdentifier, 0, "else"},
+		tMRight,
+		{itemText, 0, "\ny\n"},
+		tMLeft,
+		{itemTagType, 0, "/"},
+		{itemName, 0, "a"},
+		tMRight,
+		tEOF,
+	}},
+	{"not-standalone", " {{#a}} {{b}}\n", []item{
+		{itemText, 0, " "},
+		tMLeft,
+		{itemTagType, 0, "#"},
+		{itemIdentifier, 0, "a"},
+		tMRight,
+		{itemText, 0, " "},
+		tMLeft,
+		{itemIdentifier, 0, "b"},
+		tMRight,
+		{itemText, 0, "\n"},
+		tEOF,
+	}},
+	{"invalid-delimiters", "{{=<%=}}", []item{
+		tMLeft,
+		{itemTagType, 0, "="},
+		{itemError, 0, `invalid delimiters: "<%"`},
+	}},
+}
+
+func TestLexMustache(t *testing.T) {
+	for _, test := range lexMustacheTests {
+		items := collect(&test, MustacheOptions())
 		if !equal(items, test.items, false) {
 			t.Errorf("%s: got\n\t%v\nexpected\n\t%v", test.name, items, test.items)
 		}
@@ -197,7 +538,7 @@ var lexPosTests = []lexTest{
 // cases easier to construct. This one does.
 func TestPos(t *testing.T) {
 	for _, test := range lexPosTests {
-		items := collect(&test, "", "")
+		items := collect(&test, &Options{})
 		if !equal(items, test.items, true) {
 			t.Errorf("%s: got\n\t%v\nexpected\n\t%v", test.name, items, test.items)
 			if len(items) == len(test.items) {
@@ -233,7 +574,7 @@ var benchmarkLexTmpl = `
 `
 
 func BenchmarkLex(b *testing.B) {
-	l := lex("benchmark", benchmarkLexTmpl, "", "")
+	l := lex("benchmark", benchmarkLexTmpl, &Options{}, false)
 
 	for {
 		item := l.nextItem()
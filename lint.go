@@ -0,0 +1,357 @@
+package template
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Problem is something a Check found in a template.
+type Problem struct {
+	Name    string // Name of the template.
+	Pos     Pos    // Byte position in the template.
+	Line    int    // Line number, starting at 1.
+	Col     int    // Column in bytes, starting at 1.
+	Check   string // Name of the check that reported the problem.
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s (%s)", p.Name, p.Line, p.Col, p.Message, p.Check)
+}
+
+// Check inspects a single template. Run reports problems
+// through LintContext.Report.
+type Check struct {
+	Name string
+	Run  func(*LintContext)
+}
+
+// LintContext gives a check access to the template that is
+// linted and to all other templates in the set.
+type LintContext struct {
+	Name      string          // Name of the template being checked.
+	Root      Node            // Root of the template being checked.
+	Templates map[string]Node // All templates in the set, by name.
+	Linter    *Linter
+
+	check    string
+	source   string
+	problems *[]Problem
+}
+
+// Report records a problem at the position of node.
+func (c *LintContext) Report(node Node, format string, args ...interface{}) {
+	line, col := lineCol(c.source, node.Position())
+
+	*c.problems = append(*c.problems, Problem{
+		Name:    c.Name,
+		Pos:     node.Position(),
+		Line:    line,
+		Col:     col,
+		Check:   c.check,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// Resolve returns the name of the template that name refers to when it
+// is used in a partial or inherit tag in the template being checked.
+func (c *LintContext) Resolve(name string) (string, error) {
+	return resolveName(c.Name, name)
+}
+
+// Linter runs checks on a set of templates.
+type Linter struct {
+	Options  *Options // Delimiters and syntax of the templates.
+	MaxDepth int      // Maximum depth of nested sections.
+
+	checks []Check
+}
+
+// NewLinter returns a Linter with all checks of this package registered,
+// for templates with the delimiters and syntax of options.
+func NewLinter(options *Options) *Linter {
+	l := &Linter{Options: options, MaxDepth: 4}
+
+	for _, c := range defaultChecks {
+		l.Register(c)
+	}
+
+	return l
+}
+
+// Register adds a check to the linter. Checks run in the
+// order in which they are registered.
+func (l *Linter) Register(c Check) {
+	l.checks = append(l.checks, c)
+}
+
+// Lint parses all sources, which are keyed by template name, and runs
+// the checks on every template. Parse errors are reported as problems
+// of the check "parse". Problems are sorted by name and position.
+func (l *Linter) Lint(sources map[string]string) []Problem {
+	var problems []Problem
+	templates := make(map[string]Node)
+
+	for name, src := range sources {
+		n, err := ParseOptions(name, l.Options, src)
+		if err != nil {
+			p := Problem{Name: name, Line: 1, Col: 1, Check: "parse", Message: err.Error()}
+			if e, ok := err.(*parseError); ok {
+				p.Pos, p.Message = e.pos, e.msg
+				p.Line, p.Col = lineCol(src, e.pos)
+			}
+			problems = append(problems, p)
+			continue
+		}
+
+		templates[name] = n
+	}
+
+	for name, n := range templates {
+		for _, c := range l.checks {
+			c.Run(&LintContext{
+				Name:      name,
+				Root:      n,
+				Templates: templates,
+				Linter:    l,
+				check:     c.Name,
+				source:    sources[name],
+				problems:  &problems,
+			})
+		}
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].Name != problems[j].Name {
+			return problems[i].Name < problems[j].Name
+		}
+		return problems[i].Pos < problems[j].Pos
+	})
+
+	return problems
+}
+
+// lineCol returns the line and column of pos in input.
+func lineCol(input string, pos Pos) (line, col int) {
+	if int(pos) > len(input) {
+		pos = Pos(len(input))
+	}
+
+	text := input[:pos]
+	line = 1 + strings.Count(text, "\n")
+	col = int(pos) - strings.LastIndex(text, "\n")
+
+	return
+}
+
+// Checks
+
+var defaultChecks = []Check{
+	{"undefined-partial", checkUndefinedPartial},
+	{"undefined-parent", checkUndefinedParent},
+	{"unknown-override", checkUnknownOverride},
+	{"unused-define", checkUnusedDefine},
+	{"empty-section", checkEmptySection},
+	{"deep-nesting", checkDeepNesting},
+	{"shadowed-identifier", checkShadowedIdentifier},
+}
+
+func checkUndefinedPartial(c *LintContext) {
+	Walk(c.Root, func(n Node, _ []Node) bool {
+		if p, ok := n.(*partialNode); ok && p.Dynamic == nil {
+			if name, err := c.Resolve(p.Name()); err != nil {
+				c.Report(n, "%v", err)
+			} else if _, ok := c.Templates[name]; !ok {
+				c.Report(n, "partial %q is not defined", name)
+			}
+		}
+		return true
+	})
+}
+
+func checkUndefinedParent(c *LintContext) {
+	Walk(c.Root, func(n Node, _ []Node) bool {
+		if i, ok := n.(*inheritNode); ok {
+			if name, err := c.Resolve(i.Name()); err != nil {
+				c.Report(n, "%v", err)
+			} else if _, ok := c.Templates[name]; !ok {
+				c.Report(n, "parent %q is not defined", name)
+			}
+		}
+		return true
+	})
+}
+
+func checkUnknownOverride(c *LintContext) {
+	Walk(c.Root, func(n Node, _ []Node) bool {
+		i, ok := n.(*inheritNode)
+		if !ok {
+			return true
+		}
+
+		name, err := c.Resolve(i.Name())
+		if err != nil {
+			return true // Reported by undefined-parent.
+		}
+		if _, ok := c.Templates[name]; !ok {
+			return true // Reported by undefined-parent.
+		}
+
+		blocks := blockNames(name, c.Templates, map[string]bool{name: true})
+		for _, d := range i.Children() {
+			if d, ok := d.(*defineNode); ok && !blocks[d.Name()] {
+				c.Report(d, "block %q does not exist in parent %q", d.Name(), name)
+			}
+		}
+
+		return true
+	})
+}
+
+// blockNames returns the names of all defines that can be overridden
+// in the template tmpl, including those of the templates it inherits.
+func blockNames(tmpl string, templates map[string]Node, seen map[string]bool) map[string]bool {
+	names := make(map[string]bool)
+
+	Walk(templates[tmpl], func(n Node, _ []Node) bool {
+		switch n := n.(type) {
+		case *defineNode:
+			names[n.Name()] = true
+		case *inheritNode:
+			parent, err := resolveName(tmpl, n.Name())
+			if _, ok := templates[parent]; ok && err == nil && !seen[parent] {
+				seen[parent] = true
+				for name := range blockNames(parent, templates, seen) {
+					names[name] = true
+				}
+			}
+		}
+		return true
+	})
+
+	return names
+}
+
+func checkUnusedDefine(c *LintContext) {
+	for name, n := range c.Templates {
+		if name == c.Name {
+			continue
+		}
+
+		used := false
+		Walk(n, func(n Node, _ []Node) bool {
+			if i, ok := n.(*inheritNode); ok {
+				if parent, err := resolveName(name, i.Name()); err == nil && parent == c.Name {
+					used = true
+				}
+			}
+			return !used
+		})
+
+		if used {
+			return
+		}
+	}
+
+	Walk(c.Root, func(n Node, parents []Node) bool {
+		d, ok := n.(*defineNode)
+		if !ok {
+			return true
+		}
+
+		if _, ok := parents[len(parents)-1].(*inheritNode); !ok {
+			c.Report(d, "block %q is never overridden; no template inherits %q", d.Name(), c.Name)
+		}
+
+		return true
+	})
+}
+
+func checkEmptySection(c *LintContext) {
+	Walk(c.Root, func(n Node, _ []Node) bool {
+		if s, ok := n.(*sectionNode); ok && isBlank(s.Children()) && isBlank(s.elseChildren()) {
+			c.Report(n, "section %q is empty", s.Name())
+		}
+		return true
+	})
+}
+
+// isBlank reports whether nodes holds nothing but whitespace and comments.
+func isBlank(nodes []Node) bool {
+	for _, n := range nodes {
+		switch n := n.(type) {
+		case *textNode:
+			if strings.TrimSpace(n.Text) != "" {
+				return false
+			}
+		case *commentNode:
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+func checkDeepNesting(c *LintContext) {
+	if c.Linter.MaxDepth <= 0 {
+		return
+	}
+
+	Walk(c.Root, func(n Node, parents []Node) bool {
+		if _, ok := n.(*sectionNode); !ok {
+			return true
+		}
+
+		if depth := sectionDepth(parents) + 1; depth > c.Linter.MaxDepth {
+			c.Report(n, "section is nested %d levels deep (maximum is %d)", depth, c.Linter.MaxDepth)
+			return false
+		}
+
+		return true
+	})
+}
+
+func sectionDepth(parents []Node) (depth int) {
+	for _, p := range parents {
+		if _, ok := p.(*sectionNode); ok {
+			depth++
+		}
+	}
+	return
+}
+
+func checkShadowedIdentifier(c *LintContext) {
+	Walk(c.Root, func(n Node, parents []Node) bool {
+		s, ok := n.(*sectionNode)
+		if !ok || len(s.Tail) > 0 {
+			// Sections with arguments call functions or block helpers.
+			return true
+		}
+		id, ok := s.Head.(*identifierNode)
+		if !ok {
+			// Operators don't push a name.
+			return true
+		}
+		if _, _, anchored := id.anchor(0); anchored {
+			// Anchored paths are not searched down the stack.
+			return true
+		}
+
+		for i, p := range parents {
+			o, ok := p.(*sectionNode)
+			if !ok || i+1 < len(parents) && parents[i+1] == Node(o.Else) {
+				// The else branch is rendered in the outer context.
+				continue
+			}
+			if oid, ok := o.Head.(*identifierNode); ok && oid.path[0] == id.path[0] {
+				line, _ := lineCol(c.source, o.Position())
+				c.Report(n, "%q shadows the enclosing section on line %d", id.path[0], line)
+				break
+			}
+		}
+
+		return true
+	})
+}
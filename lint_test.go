@@ -0,0 +1,70 @@
+package template
+
+import "testing"
+
+func TestLint(t *testing.T) {
+	sources := map[string]string{
+		"base": "((! layout ))(($title))Title((/title))(($body))((/body))((>footer))((>*widget))",
+		"page": "((<base))\n(($title))Page((/title))\n(($sidebar))((/sidebar))\n((/base))((<missing))((/missing))",
+		"list": "((#items))\n((#items))x((/items))\n((/items))((#empty))  ((/empty))",
+		"deep": "((#a))((#b))((#c))((#d))((#e))x((/e))((/d))((/c))((/b))((/a))",
+		"lone": "(($unused))x((/unused))",
+		"bad":  "((#open))",
+		"bad2": "x\n  ((#a))((/b))",
+		"else": "((#user))((else))((#user))x((/user))((/user))",
+	}
+
+	expected := []string{
+		"bad:1:10: tag not closed (parse)",
+		"bad2:2:13: unexpected closing tag (parse)",
+		"base:1:57: partial \"footer\" is not defined (undefined-partial)",
+		"deep:1:25: section is nested 5 levels deep (maximum is 4) (deep-nesting)",
+		"list:2:1: \"items\" shadows the enclosing section on line 1 (shadowed-identifier)",
+		"list:3:11: section \"empty\" is empty (empty-section)",
+		"lone:1:1: block \"unused\" is never overridden; no template inherits \"lone\" (unused-define)",
+		"page:3:1: block \"sidebar\" does not exist in parent \"base\" (unknown-override)",
+		"page:4:10: parent \"missing\" is not defined (undefined-parent)",
+	}
+
+	problems := NewLinter(nil).Lint(sources)
+
+	if len(problems) != len(expected) {
+		t.Errorf("got %d problems, expected %d", len(problems), len(expected))
+	}
+
+	for i := 0; i < len(problems) && i < len(expected); i++ {
+		if r := problems[i].String(); r != expected[i] {
+			t.Errorf("#%d: got\n\t%s\nexpected\n\t%s", i, r, expected[i])
+		}
+	}
+}
+
+func TestLintRegister(t *testing.T) {
+	l := &Linter{}
+	l.Register(Check{"no-comments", func(c *LintContext) {
+		Walk(c.Root, func(n Node, _ []Node) bool {
+			if n.Type() == NodeComment {
+				c.Report(n, "comment")
+			}
+			return true
+		})
+	}})
+
+	problems := l.Lint(map[string]string{"a": "x\n  ((! c ))"})
+	if len(problems) != 1 || problems[0].String() != "a:2:3: comment (no-comments)" {
+		t.Errorf("got %v", problems)
+	}
+}
+
+func TestLintOptions(t *testing.T) {
+	sources := map[string]string{"a": "((#created-at))x((/created-at))"}
+
+	if problems := NewLinter(&Options{KebabCase: true}).Lint(sources); len(problems) != 0 {
+		t.Errorf("got %v", problems)
+	}
+
+	sources = map[string]string{"m": "{{{raw}}}\n{{=<% %>=}}\n<%#a%>x<%^%>y<%/a%>"}
+	if problems := NewLinter(MustacheOptions()).Lint(sources); len(problems) != 0 {
+		t.Errorf("got %v", problems)
+	}
+}
@@ -0,0 +1,94 @@
+package template
+
+import (
+	"io"
+	"strings"
+)
+
+// MustacheOptions returns Options for standard Mustache templates:
+//
+//   - {{ }} delimiters, which can be changed with set delimiter
+//     tags like {{=<% %>=}};
+//   - variables are HTML-escaped, except in {{{ }}} and {{& }} tags;
+//   - tags that are alone on their line don't leave an empty line,
+//     and standalone partials are indented like the tag;
+//   - partials that are not available render nothing;
+//   - there are no keywords: else, let, true, false and nil are
+//     names that are looked up like any other.
+//
+// {{.}}, the current context, is available in every syntax.
+func MustacheOptions() *Options {
+	return &Options{LeftDelim: "{{", RightDelim: "}}", Mustache: true}
+}
+
+var htmlEscaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	`"`, "&quot;",
+	"'", "&#39;",
+)
+
+// EscapeHTML escapes s like Mustache escapes variables.
+func EscapeHTML(s string) string {
+	return htmlEscaper.Replace(s)
+}
+
+// indentWriter indents the lines of a standalone Mustache partial. Only
+// text of the partial starts a new line. The indentation is written
+// before the first thing that is written on a line.
+type indentWriter struct {
+	w       io.Writer
+	indent  string
+	pending bool // The indentation of the current line is not written yet.
+}
+
+func (w *indentWriter) Write(b []byte) (int, error) {
+	if len(b) > 0 && w.pending {
+		w.pending = false
+		if _, err := io.WriteString(w.w, w.indent); err != nil {
+			return 0, err
+		}
+	}
+
+	return w.w.Write(b)
+}
+
+// indent calls fn with a writer that indents the lines
+// that are written to w by fn.
+func indent(w io.Writer, indent string, fn func(w io.Writer) error) error {
+	iw := &indentWriter{w: w, indent: indent, pending: true}
+
+	outer, nested := w.(*indentWriter)
+	if nested {
+		// The outer indentation is written with this one.
+		iw.w, iw.indent = outer.w, outer.indent+indent
+	}
+
+	err := fn(iw)
+
+	if nested {
+		outer.pending = iw.pending
+	}
+
+	return err
+}
+
+// writeText writes text of the partial.
+func (w *indentWriter) writeText(text string) error {
+	for text != "" {
+		i := strings.IndexByte(text, '\n') + 1
+		if i == 0 {
+			i = len(text)
+		}
+
+		if _, err := io.WriteString(w, text[:i]); err != nil {
+			return err
+		}
+
+		w.pending = text[i-1] == '\n'
+		text = text[i:]
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package template
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// mustacheSpec is a file of the Mustache spec.
+type mustacheSpec struct {
+	Overview string
+	Tests    []struct {
+		Name     string
+		Desc     string
+		Data     interface{}
+		Template string
+		Partials map[string]string
+		Expected string
+	}
+}
+
+// mustacheSkip lists the spec tests that are not supported, with the
+// reason. A file name skips all tests in the file.
+var mustacheSkip = map[string]string{
+	"~lambdas.json":                       "lambdas are not supported",
+	"~dynamic-names.json":                 "dynamic names are not supported",
+	"~inheritance.json/Standalone parent": "parent tags are not indented like partials",
+	"~inheritance.json/Standalone block":  "blocks are not reindented",
+}
+
+// TestMustacheSpec runs the Mustache spec in testdata/mustache.
+func TestMustacheSpec(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "mustache", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no spec files found")
+	}
+
+	for _, fn := range files {
+		if _, ok := mustacheSkip[filepath.Base(fn)]; ok {
+			continue
+		}
+
+		b, err := os.ReadFile(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var spec mustacheSpec
+		if err := json.Unmarshal(b, &spec); err != nil {
+			t.Fatalf("%s: %v", fn, err)
+		}
+
+		for _, test := range spec.Tests {
+			name := filepath.Base(fn) + "/" + test.Name
+			if _, ok := mustacheSkip[name]; ok {
+				continue
+			}
+
+			m := map[string]Node{}
+			sources := map[string]string{"test": test.Template}
+			for k, v := range test.Partials {
+				sources[k] = v
+			}
+			for k, v := range sources {
+				n, err := ParseOptions(k, MustacheOptions(), v)
+				if err != nil {
+					t.Errorf("%s: %v", name, err)
+					continue
+				}
+				m[k] = n
+			}
+
+			var buf bytes.Buffer
+			if err := New(NewNodeMap(m)).Execute(&buf, "test", test.Data); err != nil {
+				t.Errorf("%s: %v", name, err)
+			} else if buf.String() != test.Expected {
+				t.Errorf("%s: %s\ngot\n\t%q\nexpected\n\t%q", name, test.Desc, buf.String(), test.Expected)
+			}
+		}
+	}
+}
+
+func TestMustacheKeywords(t *testing.T) {
+	tests := []struct {
+		input  string
+		result string
+	}{
+		{"{{else}} {{let}} {{true}} {{false}} [{{nil}}]", "e l no yes []"},
+		{"{{#true}}t{{/true}}{{^false}}f{{/false}}{{#nil}}n{{/nil}}", "t"},
+		{"{{#else}}\n{{.}}\n{{/else}}\n{{else}}\n", "e\ne\n"},
+		{"{{#Nope}}x{{^}}y{{/Nope}}", "y"},
+	}
+
+	data := map[string]interface{}{"else": "e", "let": "l", "true": "no", "false": "yes", "nil": nil}
+
+	for _, test := range tests {
+		n, err := ParseOptions("test", MustacheOptions(), test.input)
+		if err != nil {
+			t.Errorf("%q: %v", test.input, err)
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err := New(NewNodeMap(map[string]Node{"test": n})).Execute(&buf, "test", data); err != nil {
+			t.Errorf("%q: %v", test.input, err)
+			continue
+		}
+		if buf.String() != test.result {
+			t.Errorf("%q: got %q, expected %q", test.input, buf.String(), test.result)
+		}
+	}
+}
+
+func TestMustacheDynamicPartial(t *testing.T) {
+	m := map[string]Node{}
+	for name, src := range map[string]string{"test": "[{{>*name}}][{{>*nope}}][{{>*empty}}]", "p": "p"} {
+		n, err := ParseOptions(name, MustacheOptions(), src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m[name] = n
+	}
+
+	// Partials that are missing or have no name render nothing.
+	var buf bytes.Buffer
+	data := map[string]interface{}{"name": "p", "nope": "x", "empty": ""}
+	if err := New(NewNodeMap(m)).Execute(&buf, "test", data); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "[p][][]" {
+		t.Errorf("got %q", buf.String())
+	}
+}
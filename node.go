@@ -3,6 +3,8 @@ package template
 import "strings"
 
 type Node interface {
+	Type() NodeType
+	Position() Pos // Byte position of the start of the node in the input.
 }
 
 type ParentNode interface {
@@ -16,13 +18,116 @@ type NamedNode interface {
 	Name() string
 }
 
+// ExpressionNode is a node that holds an expression,
+// i.e. a variable or a section.
+type ExpressionNode interface {
+	Node
+
+	Expression() (head Node, tail []Node)
+}
+
+// NodeType identifies the type of a node.
+type NodeType int
+
+const (
+	NodeList        NodeType = iota // A list of nodes.
+	NodeText                        // Plain text.
+	NodeVariable                    // A variable tag.
+	NodeComment                     // A comment tag.
+	NodeSection                     // A section or inverted section.
+	NodePartial                     // A partial tag.
+	NodeInherit                     // An inherit tag.
+	NodeDefine                      // A define tag.
+	NodeClose                       // A closing tag.
+	NodeIdentifier                  // An identifier in an expression.
+	NodeString                      // A string in an expression.
+	NodeNumber                      // A number in an expression.
+	NodeBinary                      // A binary operator in an expression.
+	NodeUnary                       // A unary operator in an expression.
+	NodeCall                        // A function call in an expression with operators.
+	NodeBool                        // A boolean constant, true or false.
+	NodeNil                         // The constant nil.
+	NodeListLiteral                 // A list literal in an expression.
+	NodeMapLiteral                  // A map literal in an expression.
+	NodeElse                        // An else tag.
+	NodeLet                         // A let tag.
+)
+
+var nodeTypeNames = [...]string{
+	NodeList:        "list",
+	NodeText:        "text",
+	NodeVariable:    "variable",
+	NodeComment:     "comment",
+	NodeSection:     "section",
+	NodePartial:     "partial",
+	NodeInherit:     "inherit",
+	NodeDefine:      "define",
+	NodeClose:       "close",
+	NodeIdentifier:  "identifier",
+	NodeString:      "string",
+	NodeNumber:      "number",
+	NodeBinary:      "binary",
+	NodeUnary:       "unary",
+	NodeCall:        "call",
+	NodeBool:        "bool",
+	NodeNil:         "nil",
+	NodeListLiteral: "slice",
+	NodeMapLiteral:  "map",
+	NodeElse:        "else",
+	NodeLet:         "let",
+}
+
+func (t NodeType) String() string {
+	if t >= 0 && int(t) < len(nodeTypeNames) {
+		return nodeTypeNames[t]
+	}
+	return "unknown"
+}
+
+// Walk calls fn for node and, if fn returns true, for all its children,
+// expression arguments and operands, depth-first. parents holds the ancestors
+// of a node, innermost last.
+func Walk(node Node, fn func(node Node, parents []Node) bool) {
+	walk(node, nil, fn)
+}
+
+func walk(node Node, parents []Node, fn func(Node, []Node) bool) {
+	if !fn(node, parents) {
+		return
+	}
+
+	parents = append(parents, node)
+
+	if head, tail := nodeArgs(node); head != nil {
+		walk(head, parents, fn)
+		for _, n := range tail {
+			walk(n, parents, fn)
+		}
+	}
+
+	if p, ok := node.(ParentNode); ok {
+		for _, n := range p.Children() {
+			walk(n, parents, fn)
+		}
+	}
+
+	if s, ok := node.(*sectionNode); ok && s.Else != nil {
+		walk(s.Else, parents, fn)
+	}
+}
+
 // listNode holds child nodes.
 type listNode struct {
+	Pos
 	children []Node
 }
 
-func newList() *listNode {
-	return &listNode{}
+func newList(pos Pos) *listNode {
+	return &listNode{Pos: pos}
+}
+
+func (l *listNode) Type() NodeType {
+	return NodeList
 }
 
 func (l *listNode) Append(n Node) {
@@ -35,47 +140,127 @@ func (l *listNode) Children() []Node {
 
 // textNode holds plain text.
 type textNode struct {
+	Pos
 	Text string
 }
 
-func newText(text string) *textNode {
-	return &textNode{text}
+func newText(pos Pos, text string) *textNode {
+	return &textNode{pos, text}
+}
+
+func (t *textNode) Type() NodeType {
+	return NodeText
 }
 
 // variableNode holds a list of identifiers,
 // strings and numbers (i.e. an pexression).
 type variableNode struct {
+	Pos
+	Head   Node
+	Tail   []Node
+	Escape bool // HTML-escape the value, as Mustache does.
+	Raw    bool // Marked as unescaped with {{{ }}} or {{& }}.
+}
+
+func newVariable(pos Pos, head Node, tail []Node) *variableNode {
+	return &variableNode{Pos: pos, Head: head, Tail: tail}
+}
+
+func (v *variableNode) Type() NodeType {
+	return NodeVariable
+}
+
+func (v *variableNode) Expression() (Node, []Node) {
+	return v.Head, v.Tail
+}
+
+// letNode binds the value of an expression to a name, like
+// ((let total = sum items)). The name can be used in the rest of
+// the list that holds the node, i.e. until the end of the section
+// or the template.
+type letNode struct {
+	Pos
+	name string
 	Head Node
 	Tail []Node
 }
 
-func newVariable(head Node, tail []Node) *variableNode {
-	return &variableNode{head, tail}
+func newLet(pos Pos, name string, head Node, tail []Node) *letNode {
+	return &letNode{Pos: pos, name: name, Head: head, Tail: tail}
+}
+
+func (l *letNode) Type() NodeType {
+	return NodeLet
+}
+
+func (l *letNode) Name() string {
+	return l.name
 }
 
-// commentNode holds a comment.
+func (l *letNode) Expression() (Node, []Node) {
+	return l.Head, l.Tail
+}
+
+// commentNode holds a comment. A Mustache set delimiter tag, like
+// {{=<% %>=}}, is kept as a comment with Delims set and the text
+// between the delimiters, =<% %>=.
 type commentNode struct {
-	Text string
+	Pos
+	Text   string
+	Delims bool
 }
 
-func newComment(text string) *commentNode {
-	return &commentNode{text}
+func newComment(pos Pos, text string) *commentNode {
+	return &commentNode{Pos: pos, Text: text}
 }
 
-// sectionNode holds an expression and child nodes.
+func (c *commentNode) Type() NodeType {
+	return NodeComment
+}
+
+// sectionNode holds an expression and child nodes. The head is an
+// identifier, or an operator like in ((#count > 0)). A section with an
+// identifier is closed with its name, like ((/count)), and a section
+// with an operator is closed with an empty tag, ((/)).
 type sectionNode struct {
-	Head     *identifierNode
+	Pos
+	Head     Node
 	Tail     []Node
 	Inverted bool
 	children []Node
+
+	// PushMap makes a map the context of the children, as Mustache
+	// does, instead of iterating its entries.
+	PushMap bool
+
+	// Else holds the nodes after an else tag, which are rendered in the
+	// outer context when the children are not, or nil if there is none.
+	Else *listNode
+
+	// Chained is true for a section that is opened by an else tag, like
+	// ((else #b)), and closed together with the section before it.
+	Chained bool
+}
+
+func newSection(pos Pos, head Node, tail []Node, inverted bool) *sectionNode {
+	return &sectionNode{Pos: pos, Head: head, Tail: tail, Inverted: inverted}
 }
 
-func newSection(head *identifierNode, tail []Node, inverted bool) *sectionNode {
-	return &sectionNode{Head: head, Tail: tail, Inverted: inverted}
+func (s *sectionNode) Type() NodeType {
+	return NodeSection
 }
 
+func (s *sectionNode) Expression() (Node, []Node) {
+	return s.Head, s.Tail
+}
+
+// Name returns the name that closes the section, which is empty
+// for sections that start with an operator.
 func (s *sectionNode) Name() string {
-	return s.Head.Name()
+	if id, ok := s.Head.(*identifierNode); ok {
+		return id.Name()
+	}
+	return ""
 }
 
 func (s *sectionNode) Append(n Node) {
@@ -86,13 +271,65 @@ func (s *sectionNode) Children() []Node {
 	return s.children
 }
 
+// elseChildren returns the nodes of the else branch, if any.
+func (s *sectionNode) elseChildren() []Node {
+	if s.Else == nil {
+		return nil
+	}
+	return s.Else.Children()
+}
+
+// elseNode represents an else tag, ((else)) or ((^)), or a chained
+// ((else #b)) with the section that it opens. elseNode is not included
+// in the tree; the parser moves the nodes after it to the Else list of
+// the section.
+type elseNode struct {
+	Pos
+	Section *sectionNode
+}
+
+func newElse(pos Pos, section *sectionNode) *elseNode {
+	return &elseNode{pos, section}
+}
+
+func (e *elseNode) Type() NodeType {
+	return NodeElse
+}
+
 // partialNode holds a reference to another template.
 type partialNode struct {
-	name string
+	Pos
+	name     string
+	Indent   string // Indentation of a standalone Mustache partial, added to each of its lines.
+	Optional bool   // Render nothing if the template isn't available, as Mustache does.
+
+	// Dynamic is the path of the template name in the data, for partials
+	// like ((> *widget.template)), or nil if the name is static.
+	Dynamic *identifierNode
+
+	Context Node    // Argument that is pushed as the context, or nil.
+	Params  []param // Named parameters, like title="Sale".
 }
 
-func newPartial(name string) *partialNode {
-	return &partialNode{name}
+// param is a named parameter of a partial. It shadows the data with
+// the same name in the partial.
+type param struct {
+	Key   string
+	Value Node // An identifier, string or number.
+}
+
+func newPartial(pos Pos, name string) *partialNode {
+	return &partialNode{Pos: pos, name: name}
+}
+
+// newDynamicPartial returns a partial that renders the template named
+// by the value of id.
+func newDynamicPartial(pos Pos, id *identifierNode) *partialNode {
+	return &partialNode{Pos: pos, name: "*" + id.Name(), Dynamic: id}
+}
+
+func (p *partialNode) Type() NodeType {
+	return NodePartial
 }
 
 func (p *partialNode) Name() string {
@@ -100,13 +337,20 @@ func (p *partialNode) Name() string {
 }
 
 // inheritNode holds a reference to an other template and subtemplates.
+// The child nodes are kept in source order as well as grouped by name.
 type inheritNode struct {
-	name  string
-	tmpls map[string][]Node
+	Pos
+	name     string
+	tmpls    map[string][]Node
+	children []Node
 }
 
-func newInherit(name string) *inheritNode {
-	return &inheritNode{name, make(map[string][]Node)}
+func newInherit(pos Pos, name string) *inheritNode {
+	return &inheritNode{Pos: pos, name: name, tmpls: make(map[string][]Node)}
+}
+
+func (i *inheritNode) Type() NodeType {
+	return NodeInherit
 }
 
 func (i *inheritNode) Name() string {
@@ -123,26 +367,26 @@ func (i *inheritNode) Append(n Node) {
 	}
 
 	i.tmpls[name] = append(i.tmpls[name], n)
+	i.children = append(i.children, n)
 }
 
 func (i *inheritNode) Children() []Node {
-	var children []Node
-
-	for _, n := range i.tmpls {
-		children = append(children, n...)
-	}
-
-	return children
+	return i.children
 }
 
 // defineNode has a name and holds child nodes.
 type defineNode struct {
+	Pos
 	name     string
 	children []Node
 }
 
-func newDefine(name string) *defineNode {
-	return &defineNode{name: name}
+func newDefine(pos Pos, name string) *defineNode {
+	return &defineNode{Pos: pos, name: name}
+}
+
+func (d *defineNode) Type() NodeType {
+	return NodeDefine
 }
 
 func (d *defineNode) Name() string {
@@ -161,11 +405,16 @@ func (d *defineNode) Children() []Node {
 // subtemplate or inherit tag. closeNode is not included
 // in the final tree of nodes.
 type closeNode struct {
+	Pos
 	name string
 }
 
-func newClose(name string) *closeNode {
-	return &closeNode{name}
+func newClose(pos Pos, name string) *closeNode {
+	return &closeNode{pos, name}
+}
+
+func (c *closeNode) Type() NodeType {
+	return NodeClose
 }
 
 func (c *closeNode) Name() string {
@@ -173,35 +422,206 @@ func (c *closeNode) Name() string {
 }
 
 // identifierNode holds a reference to an
-// identifier (e.g. a variable or function).
+// identifier (e.g. a variable or function). Indexes in the path are
+// kept as written, like [0] or ["Content-Type"].
 type identifierNode struct {
+	Pos
 	path []string
 }
 
-func newIdentifier(path []string) *identifierNode {
-	return &identifierNode{path}
+func newIdentifier(pos Pos, path []string) *identifierNode {
+	return &identifierNode{pos, path}
+}
+
+func (i *identifierNode) Type() NodeType {
+	return NodeIdentifier
 }
 
 func (i *identifierNode) Name() string {
-	return strings.Join(i.path, ".")
+	d := i.parents()
+	if d == len(i.path) {
+		return strings.TrimSuffix(strings.Repeat("../", d), "/")
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.Repeat("../", d))
+	b.WriteString(i.path[d])
+	for _, s := range i.path[d+1:] {
+		if !strings.HasPrefix(s, "[") {
+			b.WriteByte('.')
+		}
+		b.WriteString(s)
+	}
+
+	return b.String()
+}
+
+// parents returns the number of ".." at the start of the path.
+func (i *identifierNode) parents() int {
+	d := 0
+	for d < len(i.path) && i.path[d] == ".." {
+		d++
+	}
+	return d
+}
+
+// anchor returns the index of the context that the path starts at in
+// a stack of n contexts, and the rest of the path. "." is the current
+// context, every ".." goes up one context and "@root" is the outermost
+// context. The index is negative if the path goes above the root. Paths
+// that are not anchored are searched down the stack.
+func (i *identifierNode) anchor(n int) (index int, rest []string, ok bool) {
+	switch i.path[0] {
+	case ".":
+		return n - 1, i.path[1:], true
+	case "@root":
+		return 0, i.path[1:], true
+	case "..":
+		d := i.parents()
+		return n - 1 - d, i.path[d:], true
+	}
+
+	return 0, nil, false
 }
 
-// stringNode holds plain text.
+// stringNode holds a string literal.
 type stringNode struct {
-	Text string
+	Pos
+	Quoted string // The original text of the string, with quotes.
+	Text   string // The string after unquoting.
+}
+
+func newString(pos Pos, quoted, text string) *stringNode {
+	return &stringNode{pos, quoted, text}
+}
+
+func (s *stringNode) Type() NodeType {
+	return NodeString
+}
+
+// boolNode holds a boolean constant.
+type boolNode struct {
+	Pos
+	True bool
+}
+
+func newBool(pos Pos, b bool) *boolNode {
+	return &boolNode{pos, b}
+}
+
+func (b *boolNode) Type() NodeType {
+	return NodeBool
+}
+
+// nilNode holds the constant nil, which is a missing value.
+type nilNode struct {
+	Pos
+}
+
+func newNil(pos Pos) *nilNode {
+	return &nilNode{pos}
 }
 
-func newString(text string) *stringNode {
-	return &stringNode{text}
+func (n *nilNode) Type() NodeType {
+	return NodeNil
+}
+
+// sliceNode holds a list literal, like [1, 2, "x"]. It's
+// a []interface{} when executed.
+type sliceNode struct {
+	Pos
+	Items []Node
+}
+
+func newSlice(pos Pos, items []Node) *sliceNode {
+	return &sliceNode{pos, items}
+}
+
+func (s *sliceNode) Type() NodeType {
+	return NodeListLiteral
+}
+
+// mapNode holds a map literal, like {a: 1, "b c": "x"}. It's
+// a map[string]interface{} when executed.
+type mapNode struct {
+	Pos
+	Keys   []string
+	Values []Node
+}
+
+func newMap(pos Pos, keys []string, values []Node) *mapNode {
+	return &mapNode{pos, keys, values}
+}
+
+func (m *mapNode) Type() NodeType {
+	return NodeMapLiteral
 }
 
 // numberNode holds a number (e.g. int, uint, float, complex).
 //
 // TODO: Convert text to the actual number type.
 type numberNode struct {
+	Pos
 	Text string // Text representation of the number.
 }
 
-func newNumber(text string) *numberNode {
-	return &numberNode{text}
+func newNumber(pos Pos, text string) *numberNode {
+	return &numberNode{pos, text}
+}
+
+func (n *numberNode) Type() NodeType {
+	return NodeNumber
+}
+
+// binaryNode holds a binary operator, like == or &&, and its operands.
+type binaryNode struct {
+	Pos
+	Op          string
+	Left, Right Node
+}
+
+func newBinary(pos Pos, op string, left, right Node) *binaryNode {
+	return &binaryNode{pos, op, left, right}
+}
+
+func (b *binaryNode) Type() NodeType {
+	return NodeBinary
+}
+
+// unaryNode holds a unary operator, ! or -, and its operand. A tag that
+// starts with ! is a comment, so a variable tag that starts with a
+// negation is put in parentheses, like (((!a) && b)).
+type unaryNode struct {
+	Pos
+	Op      string
+	Operand Node
+}
+
+func newUnary(pos Pos, op string, operand Node) *unaryNode {
+	return &unaryNode{pos, op, operand}
+}
+
+func (u *unaryNode) Type() NodeType {
+	return NodeUnary
+}
+
+// callNode holds a function call that is an operand, like len items
+// in ((#len items > 0)). A call on its own is the head and tail of
+// its tag.
+type callNode struct {
+	Pos
+	Func *identifierNode
+	Args []Node
+}
+
+func newCall(pos Pos, fn *identifierNode, args []Node) *callNode {
+	return &callNode{pos, fn, args}
+}
+
+func (c *callNode) Type() NodeType {
+	return NodeCall
+}
+
+func (c *callNode) Expression() (Node, []Node) {
+	return c.Func, c.Args
 }
@@ -0,0 +1,259 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// Operators work on the values that are found in the data, so numbers
+// of any Go type can be compared and combined. Integers are combined as
+// int64, unless the other operand is a float. An operand that is missing
+// makes the result of arithmetic missing and the result of an ordering
+// comparison false.
+
+var errDivisionByZero = errors.New("division by zero")
+
+// evalBinary returns the result of the binary operator n, like
+// ((a == b)). The right operand of &&, || and ?? is only evaluated
+// when it's needed.
+func (s *state) evalBinary(n *binaryNode) (reflect.Value, error) {
+	a, err := s.evalArg(n.Left)
+	if err != nil {
+		return zero, err
+	}
+
+	switch n.Op {
+	case "&&":
+		if !isTrue(a) {
+			return reflect.ValueOf(false), nil
+		}
+	case "||":
+		if isTrue(a) {
+			return reflect.ValueOf(true), nil
+		}
+	case "??":
+		if indirect(a).IsValid() {
+			return a, nil
+		}
+	}
+
+	b, err := s.evalArg(n.Right)
+	if err != nil {
+		return zero, err
+	}
+
+	v, err := binaryOp(n.Op, a, b)
+	if err != nil {
+		return zero, s.errorf(n, "%v", err)
+	}
+
+	return v, nil
+}
+
+// evalUnary returns the result of the unary operator n.
+func (s *state) evalUnary(n *unaryNode) (reflect.Value, error) {
+	a, err := s.evalArg(n.Operand)
+	if err != nil {
+		return zero, err
+	}
+
+	v, err := unaryOp(n.Op, a)
+	if err != nil {
+		return zero, s.errorf(n, "%v", err)
+	}
+
+	return v, nil
+}
+
+// binaryOp applies op to a and b. The right operand of &&, || and ??
+// must only be passed if the left one doesn't decide the result.
+func binaryOp(op string, a, b reflect.Value) (reflect.Value, error) {
+	switch op {
+	case "&&", "||":
+		return reflect.ValueOf(isTrue(b)), nil
+	case "??":
+		if indirect(a).IsValid() {
+			return a, nil
+		}
+		return b, nil
+	case "==":
+		return reflect.ValueOf(valuesEqual(a, b)), nil
+	case "!=":
+		return reflect.ValueOf(!valuesEqual(a, b)), nil
+	}
+
+	a, b = indirect(a), indirect(b)
+
+	switch op {
+	case "<", "<=", ">", ">=":
+		if !a.IsValid() || !b.IsValid() {
+			return reflect.ValueOf(false), nil
+		}
+
+		c, err := compare(a, b)
+		if err != nil {
+			return zero, err
+		}
+
+		switch op {
+		case "<":
+			return reflect.ValueOf(c < 0), nil
+		case "<=":
+			return reflect.ValueOf(c <= 0), nil
+		case ">":
+			return reflect.ValueOf(c > 0), nil
+		}
+		return reflect.ValueOf(c >= 0), nil
+	}
+
+	if !a.IsValid() || !b.IsValid() {
+		return zero, nil
+	}
+
+	if op == "+" && a.Kind() == reflect.String && b.Kind() == reflect.String {
+		return reflect.ValueOf(a.String() + b.String()), nil
+	}
+
+	return arithmetic(op, a, b)
+}
+
+// unaryOp applies op, ! or -, to a.
+func unaryOp(op string, a reflect.Value) (reflect.Value, error) {
+	if op == "!" {
+		return reflect.ValueOf(!isTrue(a)), nil
+	}
+
+	a = indirect(a)
+	if !a.IsValid() {
+		return zero, nil
+	}
+
+	switch i, f, isInt, ok := number(a); {
+	case !ok:
+		return zero, fmt.Errorf("invalid operation: -%s", a.Type())
+	case isInt:
+		return reflect.ValueOf(-i), nil
+	default:
+		return reflect.ValueOf(-f), nil
+	}
+}
+
+// number returns v as an int64 if it's an integer or as a float64 if
+// it's a float. ok is false if v isn't a number.
+func number(v reflect.Value) (i int64, f float64, isInt, ok bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), float64(v.Int()), true, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return int64(v.Uint()), float64(v.Uint()), true, true
+	case reflect.Float32, reflect.Float64:
+		return 0, v.Float(), false, true
+	}
+
+	return 0, 0, false, false
+}
+
+// valuesEqual reports whether a and b are equal. Numbers are equal if their
+// values are, whatever their types. Two missing values are equal.
+func valuesEqual(a, b reflect.Value) bool {
+	a, b = indirect(a), indirect(b)
+
+	switch {
+	case !a.IsValid() || !b.IsValid():
+		return a.IsValid() == b.IsValid()
+	case a.Kind() == reflect.String && b.Kind() == reflect.String:
+		return a.String() == b.String()
+	case a.Kind() == reflect.Bool && b.Kind() == reflect.Bool:
+		return a.Bool() == b.Bool()
+	}
+
+	if ai, af, aInt, ok := number(a); ok {
+		bi, bf, bInt, ok := number(b)
+		if aInt && bInt {
+			return ok && ai == bi
+		}
+		return ok && af == bf
+	}
+
+	return a.Type() == b.Type() && a.Type().Comparable() && a.Interface() == b.Interface()
+}
+
+// compare returns -1, 0 or 1 if a is less than, equal to or greater
+// than b. Only numbers and strings can be compared.
+func compare(a, b reflect.Value) (int, error) {
+	if a.Kind() == reflect.String && b.Kind() == reflect.String {
+		switch x, y := a.String(), b.String(); {
+		case x < y:
+			return -1, nil
+		case x > y:
+			return 1, nil
+		}
+		return 0, nil
+	}
+
+	ai, af, aInt, aok := number(a)
+	bi, bf, bInt, bok := number(b)
+	if !aok || !bok {
+		return 0, fmt.Errorf("cannot compare %s and %s", a.Type(), b.Type())
+	}
+
+	if aInt && bInt {
+		switch {
+		case ai < bi:
+			return -1, nil
+		case ai > bi:
+			return 1, nil
+		}
+		return 0, nil
+	}
+
+	switch {
+	case af < bf:
+		return -1, nil
+	case af > bf:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// arithmetic applies op, + - * / or %, to the numbers a and b.
+func arithmetic(op string, a, b reflect.Value) (reflect.Value, error) {
+	ai, af, aInt, aok := number(a)
+	bi, bf, bInt, bok := number(b)
+	if !aok || !bok {
+		return zero, fmt.Errorf("invalid operation: %s %s %s", a.Type(), op, b.Type())
+	}
+
+	if aInt && bInt {
+		switch op {
+		case "+":
+			return reflect.ValueOf(ai + bi), nil
+		case "-":
+			return reflect.ValueOf(ai - bi), nil
+		case "*":
+			return reflect.ValueOf(ai * bi), nil
+		}
+
+		if bi == 0 {
+			return zero, errDivisionByZero
+		}
+		if op == "/" {
+			return reflect.ValueOf(ai / bi), nil
+		}
+		return reflect.ValueOf(ai % bi), nil
+	}
+
+	switch op {
+	case "+":
+		return reflect.ValueOf(af + bf), nil
+	case "-":
+		return reflect.ValueOf(af - bf), nil
+	case "*":
+		return reflect.ValueOf(af * bf), nil
+	case "/":
+		return reflect.ValueOf(af / bf), nil
+	}
+	return reflect.ValueOf(math.Mod(af, bf)), nil
+}
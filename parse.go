@@ -1,22 +1,44 @@
 package template
 
 import (
-	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 )
 
 type parser struct {
-	name string
-	lex  *lexer
-	err  error
+	name     string
+	lex      *lexer
+	err      error
+	mustache bool
 
 	token     [3]item
 	peekCount int
 }
 
 func Parse(name, leftDelim, rightDelim, input string) (ParentNode, error) {
-	p := &parser{name: name, lex: lex(name, input, leftDelim, rightDelim)}
-	root := newList()
+	return ParseOptions(name, &Options{LeftDelim: leftDelim, RightDelim: rightDelim}, input)
+}
+
+// ParseOptions parses input with the delimiters and syntax of options.
+func ParseOptions(name string, options *Options, input string) (ParentNode, error) {
+	return parseSource(name, options, input, false)
+}
+
+// parseSource is ParseOptions. If keepSpace is set, the whitespace
+// around standalone Mustache tags is kept as text, so that printing
+// the tree gives back the input.
+func parseSource(name string, options *Options, input string, keepSpace bool) (ParentNode, error) {
+	if options == nil {
+		options = &Options{}
+	}
+
+	p := &parser{
+		name:     name,
+		lex:      lex(name, input, options, keepSpace),
+		mustache: options.Mustache,
+	}
+	root := newList(0)
 
 	if !p.parse(root) {
 		return nil, p.err
@@ -70,6 +92,11 @@ func (p *parser) peekNonSpace() (token item) {
 }
 
 func (p *parser) errorf(format string, args ...interface{}) Node {
+	if p.err != nil {
+		// Keep the first error.
+		return nil
+	}
+
 	// Give priority to itemError tokens.
 	var msg string
 	if p.token[0].typ == itemError {
@@ -78,12 +105,23 @@ func (p *parser) errorf(format string, args ...interface{}) Node {
 		msg = fmt.Sprintf(format, args...)
 	}
 
-	p.err = errors.New(fmt.Sprintf(
-		"%s:%d: %s", p.name, p.lex.lineNumber(), msg))
+	p.err = &parseError{p.name, p.lex.lastPos, p.lex.lineNumber(), msg}
 
 	return nil
 }
 
+// parseError is a syntax error at a position in a template.
+type parseError struct {
+	name string
+	pos  Pos
+	line int
+	msg  string
+}
+
+func (e *parseError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.name, e.line, e.msg)
+}
+
 // Parse functions
 
 func (p *parser) parse(parent ParentNode) bool {
@@ -95,6 +133,11 @@ func (p *parser) parse(parent ParentNode) bool {
 		close = false
 	}
 
+	// Nodes are added to target, which is the Else list or the chained
+	// section after an else tag. An else tag belongs to open.
+	target := parent
+	open, _ := parent.(*sectionNode)
+
 	for {
 		t := p.peek()
 
@@ -111,14 +154,33 @@ func (p *parser) parse(parent ParentNode) bool {
 
 		if n := p.textOrTag(); n != nil {
 			if c, ok := n.(*closeNode); ok {
-				if name != c.Name() {
+				switch {
+				case !close && name == "" && c.Name() != "":
+					p.errorf("section with an operator must be closed with an empty closing tag, but got: %s", c.Name())
+				case close || name != c.Name():
 					p.errorf("unexpected closing tag")
 				}
 
 				break
 			}
 
-			parent.Append(n)
+			if e, ok := n.(*elseNode); ok {
+				if open == nil {
+					p.errorf("unexpected else tag")
+					break
+				}
+
+				open.Else = newList(e.Pos)
+				if e.Section != nil {
+					open.Else.Append(e.Section)
+					target, open = e.Section, e.Section
+				} else {
+					target, open = open.Else, nil
+				}
+				continue
+			}
+
+			target.Append(n)
 		} else {
 			break
 		}
@@ -132,58 +194,91 @@ func (p *parser) textOrTag() Node {
 
 	switch t.typ {
 	case itemText:
-		return newText(t.val)
+		return newText(t.pos, t.val)
 	case itemLeftDelim:
-		return p.parseTag()
+		return p.parseTag(t.pos)
+	case itemIndent:
+		// Always followed by a standalone partial.
+		n, ok := p.textOrTag().(*partialNode)
+		if !ok {
+			return p.errorf("expected a partial")
+		}
+		n.Indent = t.val
+		return n
 	}
 
 	return p.errorf("unexpected token: %s", t.val)
 }
 
-func (p *parser) parseTag() Node {
+func (p *parser) parseTag(pos Pos) Node {
 	t := p.peekNonSpace()
 
 	switch t.typ {
 	case itemRightDelim:
 		p.nextNonSpace()
 		return p.errorf("empty tags are not allowed")
-	case itemIdentifier, itemString, itemNumber:
-		return p.parseVariable()
+	case itemIdentifier, itemString, itemNumber, itemOperator, itemLeftParen, itemLeftBracket, itemLeftBrace:
+		// Mustache has no keywords, so else and let are names there.
+		if t.typ == itemIdentifier && t.val == "else" && !p.mustache {
+			p.nextNonSpace()
+			return p.parseElse(pos)
+		}
+		if t.typ == itemIdentifier && t.val == "let" && !p.mustache {
+			p.nextNonSpace()
+			return p.parseLet(pos)
+		}
+		return p.parseVariable(pos, false)
 	case itemTagType:
 		p.nextNonSpace()
 
 		switch t.val {
 		case "!":
-			return p.parseComment()
+			return p.parseComment(pos)
+		case "{", "&":
+			return p.parseVariable(pos, true)
+		case "=":
+			return p.parseSetDelims(pos)
 		case "#":
-			return p.parseSection(false)
+			return p.parseSection(pos, false)
 		case "^":
-			return p.parseSection(true)
+			return p.parseSection(pos, true)
 		case ">":
-			return p.parsePartial()
+			return p.parsePartial(pos)
 		case "<":
-			return p.parseInherit()
+			return p.parseInherit(pos)
 		case "$":
-			return p.parseDefine()
+			return p.parseDefine(pos)
 		case "/":
-			return p.parseClose()
+			return p.parseClose(pos)
 		}
 	}
 
 	return p.errorf("unexpected token: %s", t.val)
 }
 
-func (p *parser) parseVariable() Node {
+// parseVariable parses a variable tag. A raw variable is a Mustache
+// variable that is not escaped.
+func (p *parser) parseVariable(pos Pos, raw bool) Node {
 	head, tail := p.parseExpression()
+	if head == nil {
+		if p.err != nil {
+			return nil
+		}
+		return p.errorf("unexpected token: %s", p.peekNonSpace().val)
+	}
 
 	if t := p.nextNonSpace(); t.typ != itemRightDelim {
 		return p.errorf("unexpected token: %s", t.val)
 	}
 
-	return newVariable(head, tail)
+	n := newVariable(pos, head, tail)
+	n.Escape = p.mustache && !raw
+	n.Raw = raw
+
+	return n
 }
 
-func (p *parser) parseComment() Node {
+func (p *parser) parseComment(pos Pos) Node {
 	t := p.nextNonSpace()
 	v := ""
 
@@ -193,66 +288,156 @@ func (p *parser) parseComment() Node {
 	}
 
 	if t.typ == itemRightDelim {
-		return newComment(v)
+		return newComment(pos, v)
 	}
 
 	return p.errorf("unexpected token: %s", t.val)
 }
 
-func (p *parser) parseSection(inverted bool) Node {
-	temp, tail := p.parseExpression()
-
-	head, ok := temp.(*identifierNode)
-	if !ok {
-		return p.errorf("expression in section must start with identifier")
+// parseSetDelims parses a Mustache set delimiter tag. The lexer has
+// already switched the delimiters, so it's kept as a comment.
+func (p *parser) parseSetDelims(pos Pos) Node {
+	t := p.nextNonSpace()
+	if t.typ != itemString {
+		return p.errorf("unexpected token: %s", t.val)
 	}
 
-	if t := p.nextNonSpace(); t.typ != itemRightDelim {
-		return p.errorf("unexpected token: %s", t.val)
+	if r := p.nextNonSpace(); r.typ != itemRightDelim {
+		return p.errorf("unexpected token: %s", r.val)
 	}
 
-	node := newSection(head, tail, inverted)
+	c := newComment(pos, "="+t.val+"=")
+	c.Delims = true
+	return c
+}
 
-	if !p.parse(node) {
+func (p *parser) parseSection(pos Pos, inverted bool) Node {
+	if inverted && p.peekNonSpace().typ == itemRightDelim {
+		// ((^)) is the Mustache-style else tag.
+		p.nextNonSpace()
+		return newElse(pos, nil)
+	}
+
+	node := p.parseSectionTag(pos, inverted)
+	if node == nil || !p.parse(node) {
 		return nil
 	}
 
 	return node
 }
 
-func (p *parser) parsePartial() Node {
-	name := p.parseName()
-	if name == "" {
+// parseElse parses an else tag, after the else. It's either ((else)) or
+// chained with a section, like ((else #b)), which has its own else tag.
+func (p *parser) parseElse(pos Pos) Node {
+	t := p.nextNonSpace()
+	if t.typ == itemRightDelim {
+		return newElse(pos, nil)
+	}
+
+	if t.typ != itemTagType || t.val != "#" && t.val != "^" {
+		return p.errorf("expected a section after else, but got: %s", t.val)
+	}
+
+	node := p.parseSectionTag(t.pos, t.val == "^")
+	if node == nil {
 		return nil
 	}
+	node.Chained = true
 
-	if t := p.nextNonSpace(); t.typ != itemRightDelim {
-		return p.errorf("expected a delimiter, but got: %s", t.val)
+	return newElse(pos, node)
+}
+
+// parseLet parses a let tag, like ((let total = sum items)), after
+// the let.
+func (p *parser) parseLet(pos Pos) Node {
+	t := p.nextNonSpace()
+	if t.typ != itemIdentifier || !isAlpha([]rune(t.val)[0]) || keywords[t.val] {
+		return p.errorf("expected a name after let, but got: %s", t.val)
 	}
 
-	return newPartial(name)
+	if a := p.nextNonSpace(); a.typ != itemAssign {
+		return p.errorf("expected = after let %s, but got: %s", t.val, a.val)
+	}
+
+	head, tail := p.parseExpression()
+	if head == nil {
+		if p.err != nil {
+			return nil
+		}
+		return p.errorf("missing value of let %s", t.val)
+	}
+
+	if r := p.nextNonSpace(); r.typ != itemRightDelim {
+		return p.errorf("unexpected token: %s", r.val)
+	}
+
+	return newLet(pos, t.val, head, tail)
 }
 
-func (p *parser) parseDefine() Node {
-	name := p.parseName()
-	if name == "" {
+// keywords holds the names that can't be bound with let.
+var keywords = map[string]bool{"true": true, "false": true, "nil": true, "else": true, "let": true}
+
+// parseSectionTag parses the expression of a section tag and returns
+// the section without its children.
+func (p *parser) parseSectionTag(pos Pos, inverted bool) *sectionNode {
+	head, tail := p.parseExpression()
+
+	switch head.(type) {
+	case nil:
+		if p.err == nil {
+			p.errorf("expression in section must start with identifier")
+		}
+		return nil
+	case *stringNode, *numberNode, *boolNode, *nilNode, *sliceNode, *mapNode:
+		p.errorf("expression in section must start with identifier")
 		return nil
 	}
 
 	if t := p.nextNonSpace(); t.typ != itemRightDelim {
-		return p.errorf("expected a delimiter, but got: %s", t.val)
+		p.errorf("unexpected token: %s", t.val)
+		return nil
 	}
 
-	node := newDefine(name)
+	n := newSection(pos, head, tail, inverted)
+	n.PushMap = p.mustache
 
-	if !p.parse(node) {
+	return n
+}
+
+func (p *parser) parsePartial(pos Pos) Node {
+	var n *partialNode
+
+	if t := p.peekNonSpace(); t.typ == itemTagType && t.val == "*" {
+		p.nextNonSpace()
+
+		if t := p.peekNonSpace(); t.typ != itemIdentifier {
+			return p.errorf("dynamic partial must be an identifier, but got: %s", t.val)
+		}
+
+		n = newDynamicPartial(pos, p.parseIdentifier())
+	} else {
+		name := p.parseName()
+		if name == "" {
+			return nil
+		}
+
+		n = newPartial(pos, name)
+	}
+
+	if !p.parsePartialArgs(n) {
 		return nil
 	}
 
-	return node
+	if t := p.nextNonSpace(); t.typ != itemRightDelim {
+		return p.errorf("expected a delimiter, but got: %s", t.val)
+	}
+
+	n.Optional = p.mustache
+
+	return n
 }
 
-func (p *parser) parseInherit() Node {
+func (p *parser) parseDefine(pos Pos) Node {
 	name := p.parseName()
 	if name == "" {
 		return nil
@@ -262,7 +447,7 @@ func (p *parser) parseInherit() Node {
 		return p.errorf("expected a delimiter, but got: %s", t.val)
 	}
 
-	node := newInherit(name)
+	node := newDefine(pos, name)
 
 	if !p.parse(node) {
 		return nil
@@ -271,7 +456,7 @@ func (p *parser) parseInherit() Node {
 	return node
 }
 
-func (p *parser) parseClose() Node {
+func (p *parser) parseInherit(pos Pos) Node {
 	name := p.parseName()
 	if name == "" {
 		return nil
@@ -281,48 +466,331 @@ func (p *parser) parseClose() Node {
 		return p.errorf("expected a delimiter, but got: %s", t.val)
 	}
 
-	return newClose(name)
+	node := newInherit(pos, name)
+
+	if !p.parse(node) {
+		return nil
+	}
+
+	return node
 }
 
-func (p *parser) parseExpression() (head Node, tail []Node) {
+// parsePartialArgs parses the context argument and the parameters of a
+// partial, like ((> card item title="Sale")).
+func (p *parser) parsePartialArgs(n *partialNode) bool {
+	for {
+		arg := p.parseArg()
+		if arg == nil {
+			return p.err == nil
+		}
+
+		if p.peek().typ != itemAssign {
+			if n.Context != nil || len(n.Params) > 0 {
+				p.errorf("a partial has one context argument, before the parameters")
+				return false
+			}
+			n.Context = arg
+			continue
+		}
+
+		p.next()
+		key, ok := arg.(*identifierNode)
+		if !ok || len(key.path) != 1 || strings.HasPrefix(key.path[0], ".") || strings.HasPrefix(key.path[0], "@") {
+			p.errorf("parameter name must be a name, but got: %s", argString(arg))
+			return false
+		}
+
+		value := p.parseArg()
+		if value == nil || p.peek().typ == itemAssign {
+			p.errorf("missing value of parameter %s", key.Name())
+			return false
+		}
+
+		n.Params = append(n.Params, param{key.path[0], value})
+	}
+}
+
+// parseArg parses an identifier, a constant, or a list or map literal,
+// or returns nil if there is none.
+func (p *parser) parseArg() Node {
 	t := p.peekNonSpace()
 
 	switch t.typ {
 	case itemIdentifier:
-		head = p.parseIdentifier()
+		id := p.parseIdentifier()
+		if len(id.path) == 1 && !p.mustache {
+			switch id.path[0] {
+			case "true", "false":
+				return newBool(id.Pos, id.path[0] == "true")
+			case "nil":
+				return newNil(id.Pos)
+			}
+		}
+		return id
 	case itemString:
 		p.nextNonSpace()
-		head = newString(t.val)
+		return p.newString(t)
 	case itemNumber:
 		p.nextNonSpace()
-		head = newNumber(t.val)
-	}
-
-	if _, ok := head.(*identifierNode); ok {
-	Loop:
-		for {
-			t = p.peekNonSpace()
-
-			switch t.typ {
-			case itemIdentifier:
-				tail = append(tail, p.parseIdentifier())
-			case itemString:
-				p.nextNonSpace()
-				tail = append(tail, newString(t.val))
-			case itemNumber:
-				p.nextNonSpace()
-				tail = append(tail, newNumber(t.val))
-			default:
-				break Loop
+		return newNumber(t.pos, t.val)
+	case itemLeftBracket:
+		p.nextNonSpace()
+		return p.parseSlice(t.pos)
+	case itemLeftBrace:
+		p.nextNonSpace()
+		return p.parseMap(t.pos)
+	case itemLeftParen:
+		p.nextNonSpace()
+		return p.parseParen()
+	}
+
+	return nil
+}
+
+// parseSlice parses the elements of a list literal, like [1, 2, "x"].
+// The [ has been read.
+func (p *parser) parseSlice(pos Pos) Node {
+	var items []Node
+
+	for p.peekNonSpace().typ != itemRightBracket {
+		item := p.parseArg()
+		if item == nil {
+			return p.errorf("unexpected token in list: %s", p.peekNonSpace().val)
+		}
+		items = append(items, item)
+
+		if !p.parseComma(itemRightBracket) {
+			return nil
+		}
+	}
+	p.nextNonSpace()
+
+	return newSlice(pos, items)
+}
+
+// parseMap parses the entries of a map literal, like {a: 1, "b c": "x"}.
+// The { has been read.
+func (p *parser) parseMap(pos Pos) Node {
+	var (
+		keys   []string
+		values []Node
+		seen   = make(map[string]bool)
+	)
+
+	for p.peekNonSpace().typ != itemRightBrace {
+		t := p.nextNonSpace()
+
+		var key string
+		switch {
+		case t.typ == itemIdentifier && isAlpha([]rune(t.val)[0]):
+			key = t.val
+		case t.typ == itemString:
+			key, _ = strconv.Unquote(t.val)
+		default:
+			return p.errorf("map key must be a name or a string, but got: %s", t.val)
+		}
+
+		if seen[key] {
+			return p.errorf("duplicate key %s in map", t.val)
+		}
+		seen[key] = true
+
+		if c := p.nextNonSpace(); c.typ != itemColon {
+			return p.errorf("expected a colon after map key %s, but got: %s", t.val, c.val)
+		}
+
+		value := p.parseArg()
+		if value == nil {
+			return p.errorf("missing value of map key %s", t.val)
+		}
+		keys, values = append(keys, key), append(values, value)
+
+		if !p.parseComma(itemRightBrace) {
+			return nil
+		}
+	}
+	p.nextNonSpace()
+
+	return newMap(pos, keys, values)
+}
+
+// closers holds the characters that end list and map literals.
+var closers = map[itemType]string{itemRightBracket: "]", itemRightBrace: "}"}
+
+// parseComma parses the comma after an element of a list or map, which
+// may be left out before the end of the literal.
+func (p *parser) parseComma(end itemType) bool {
+	switch t := p.peekNonSpace(); t.typ {
+	case itemComma:
+		p.nextNonSpace()
+		return true
+	case end:
+		return true
+	default:
+		p.errorf("expected , or %s, but got: %s", closers[end], t.val)
+		return false
+	}
+}
+
+// parseClose parses a closing tag. Sections that start with an
+// operator are closed without a name.
+func (p *parser) parseClose(pos Pos) Node {
+	name := ""
+	if p.peekNonSpace().typ != itemRightDelim {
+		if name = p.parseName(); name == "" {
+			return nil
+		}
+	}
+
+	if t := p.nextNonSpace(); t.typ != itemRightDelim {
+		return p.errorf("expected a delimiter, but got: %s", t.val)
+	}
+
+	return newClose(pos, name)
+}
+
+// binaryPrecedence holds the precedence of the binary operators.
+// Operators with a higher precedence bind tighter.
+var binaryPrecedence = map[string]int{
+	"??": 1,
+	"||": 2,
+	"&&": 3,
+	"==": 4, "!=": 4,
+	"<": 5, "<=": 5, ">": 5, ">=": 5,
+	"+": 6, "-": 6,
+	"*": 7, "/": 7, "%": 7,
+}
+
+// unaryPrecedence is the precedence of ! and -, which bind tighter than
+// any binary operator.
+const unaryPrecedence = 8
+
+// parseExpression parses a call, like "name arg1 arg2", which is returned
+// as head and tail, or an expression with operators, like
+// "count > 0 && !hidden", which is returned as head.
+func (p *parser) parseExpression() (head Node, tail []Node) {
+	if t := p.peekNonSpace(); t.typ == itemOperator || t.typ == itemLeftParen {
+		return p.parseBinary(p.parseUnary(), 1), nil
+	}
+
+	head, tail = p.parseCall()
+	if head == nil || p.peekNonSpace().typ != itemOperator {
+		return head, tail
+	}
+
+	return p.parseBinary(operand(head, tail), 1), nil
+}
+
+// parseBinary parses the binary operators that follow left, as long as
+// their precedence is at least minPrec.
+func (p *parser) parseBinary(left Node, minPrec int) Node {
+	for left != nil {
+		t := p.peekNonSpace()
+		prec := binaryPrecedence[t.val]
+		if t.typ != itemOperator || prec == 0 || prec < minPrec {
+			return left
+		}
+		p.nextNonSpace()
+
+		right := p.parseUnary()
+		for right != nil {
+			n := p.peekNonSpace()
+			if n.typ != itemOperator || binaryPrecedence[n.val] <= prec {
+				break
 			}
+			right = p.parseBinary(right, prec+1)
 		}
+		if right == nil {
+			return nil
+		}
+
+		left = newBinary(t.pos, t.val, left, right)
 	}
 
-	return
+	return nil
+}
+
+// parseUnary parses an operand of a binary operator: a call, a string,
+// a number or an expression in parentheses, after any unary operators.
+func (p *parser) parseUnary() Node {
+	t := p.nextNonSpace()
+
+	switch {
+	case t.typ == itemOperator && (t.val == "!" || t.val == "-"):
+		n := p.parseUnary()
+		if n == nil {
+			return nil
+		}
+		return newUnary(t.pos, t.val, n)
+	case t.typ == itemLeftParen:
+		return p.parseParen()
+	}
+
+	p.backup()
+	head, tail := p.parseCall()
+	if head == nil {
+		return p.errorf("expected an operand, but got: %s", t.val)
+	}
+
+	return operand(head, tail)
+}
+
+// parseParen parses an expression in parentheses, like (a + 1) or (-x)
+// as an argument. The ( has been read.
+func (p *parser) parseParen() Node {
+	head, tail := p.parseExpression()
+	if head == nil {
+		if p.err != nil {
+			return nil
+		}
+		return p.errorf("expected an operand, but got: %s", p.peekNonSpace().val)
+	}
+	if r := p.nextNonSpace(); r.typ != itemRightParen {
+		return p.errorf("unclosed parenthesis, got: %s", r.val)
+	}
+	return operand(head, tail)
+}
+
+// operand returns an expression as a single node, which is a call
+// if it has arguments.
+func operand(head Node, tail []Node) Node {
+	if len(tail) == 0 {
+		return head
+	}
+	return newCall(head.Position(), head.(*identifierNode), tail)
+}
+
+// parseCall parses an identifier with its arguments, or a constant
+// or literal.
+func (p *parser) parseCall() (head Node, tail []Node) {
+	head = p.parseArg()
+	if _, ok := head.(*identifierNode); !ok {
+		return head, nil
+	}
+
+	for {
+		arg := p.parseArg()
+		if arg == nil {
+			return head, tail
+		}
+		tail = append(tail, arg)
+	}
+}
+
+// newString returns the node of the string literal t, which the lexer
+// has checked. Strings are unquoted as Go does.
+func (p *parser) newString(t item) Node {
+	text, err := strconv.Unquote(t.val)
+	if err != nil {
+		return p.errorf("invalid string: %s", t.val)
+	}
+
+	return newString(t.pos, t.val, text)
 }
 
 func (p *parser) parseIdentifier() *identifierNode {
 	var s []string
+	pos := p.peek().pos
 
 Loop:
 	for {
@@ -340,7 +808,7 @@ Loop:
 		p.next()
 	}
 
-	return newIdentifier(s)
+	return newIdentifier(pos, s)
 }
 
 func (p *parser) parseName() (name string) {
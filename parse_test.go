@@ -24,11 +24,46 @@ var parseTests = []parseTest{
 	{"define", `(($test))((/test))`, noError, ""},
 	{"comment", `((! comment))`, noError, ""},
 	{"partial", `((>partial))`, noError, ""},
+	{"dynamic-partial", `((> *a.b))`, noError, ""},
+	{"partial-args", `((> a b.c d="e" f=1 g=h.i))((> *a b c=d))`, noError, ""},
+	{"partial-two-contexts", `((> a b c))`, hasError, "partial-two-contexts:1: a partial has one context argument, before the parameters"},
+	{"partial-context-after-params", `((> a b=c d))`, hasError, "partial-context-after-params:1: a partial has one context argument, before the parameters"},
+	{"partial-bad-param", `((> a b.c=d))`, hasError, "partial-bad-param:1: parameter name must be a name, but got: b.c"},
+	{"partial-missing-value", `((> a b=))`, hasError, "partial-missing-value:1: missing value of parameter b"},
+	{"dynamic-partial-string", `((> *"a"))`, hasError, `dynamic-partial-string:1: dynamic partial must be an identifier, but got: "a"`},
+	{"operators", `((a == 1 && !(b || -c) ?? "d"))((#count > 0))((/))((^f x < 2))((/))`, noError, ""},
+	{"missing-operand", `((a &&))`, hasError, "missing-operand:1: expected an operand, but got: ))"},
+	{"unclosed-parenthesis", `((a + (b = c)))`, hasError, "unclosed-parenthesis:1: unclosed parenthesis, got: ="},
+	{"unary-operator", `((a ! b))`, hasError, "unary-operator:1: unexpected token: !"},
+	{"close-operator-name", `((#a > 0))((/a))`, hasError, "close-operator-name:1: section with an operator must be closed with an empty closing tag, but got: a"},
+	{"close-without-name", `((/))`, hasError, "close-without-name:1: unexpected closing tag"},
+	{"bad-escape", "a\n((b \"c\\d\"))", hasError, `bad-escape:2: invalid escape sequence \d at column 7`},
+	{"literals", `((f true false nil [] [1, "a", b.c,] {a: 1, "b c": [x]}))((> p {k: v} x=[1, 2]))`, noError, ""},
+	{"unclosed-list", `((f [1, 2))`, hasError, "unclosed-list:1: expected , or ], but got: )"},
+	{"unclosed-map", `((f {a: 1))`, hasError, "unclosed-map:1: expected , or }, but got: )"},
+	{"missing-comma", `((f [1 2]))`, hasError, "missing-comma:1: expected , or ], but got: 2"},
+	{"duplicate-key", `((f {a: 1, "a": 2}))`, hasError, `duplicate-key:1: duplicate key "a" in map`},
+	{"bad-key", `((f {1: 2}))`, hasError, "bad-key:1: map key must be a name or a string, but got: 1"},
+	{"missing-colon", `((f {a 1}))`, hasError, "missing-colon:1: expected a colon after map key a, but got: 1"},
+	{"keyword-param", `((> a true=1))`, hasError, "keyword-param:1: parameter name must be a name, but got: true"},
+	{"literal-section", `((#[a]))((/))`, hasError, "literal-section:1: expression in section must start with identifier"},
+	{"else", `((#a))x((else))y((/a))((^b))x((^))y((/b))((#c > 0))((else #d))((else ^e x))((else))((/))`, noError, ""},
+	{"unexpected-else", "((else))", hasError, "unexpected-else:1: unexpected else tag"},
+	{"else-twice", "((#a))((else))((else))((/a))", hasError, "else-twice:1: unexpected else tag"},
+	{"else-in-define", "(($a))((else))((/a))", hasError, "else-in-define:1: unexpected else tag"},
+	{"else-without-section", "((#a))((else b))((/a))", hasError, "else-without-section:1: expected a section after else, but got: b"},
+	{"else-close-chained", "((#a))((else #b))((/b))", hasError, "else-close-chained:1: unexpected closing tag"},
+	{"let", "((let a = 1))((let b = f a.b))((#c))((let d = b > 1))((/c))", noError, ""},
+	{"let-no-name", "((let = 1))", hasError, "let-no-name:1: expected a name after let, but got: ="},
+	{"let-keyword", "((let nil = 1))", hasError, "let-keyword:1: expected a name after let, but got: nil"},
+	{"let-path", "((let a.b = 1))", hasError, "let-path:1: expected = after let a, but got: ."},
+	{"let-missing-value", "((let a =))", hasError, "let-missing-value:1: missing value of let a"},
+	{"let-extra", "((let a = 1 2))", hasError, "let-extra:1: unexpected token: 2"},
 	{"incorrect-section", `((^3.14))((/3.14))`, hasError, "incorrect-section:1: expression in section must start with identifier"},
 	{"unclosed-section", "((#test))", hasError, "unclosed-section:1: tag not closed"},
 	{"close-tag", "((/test))", hasError, "close-tag:1: unexpected closing tag"},
 	{"empty-tag", "(())", hasError, "empty-tag:1: empty tags are not allowed"},
-	{"unknown", "((%test))", hasError, "unknown:1: unrecognized character in tag: U+0025 '%'"},
+	{"unknown", "((;test))", hasError, "unknown:1: unrecognized character in tag: U+003B ';'"},
 	{"unclosed", "((unclosed", hasError, "unclosed:1: unclosed tag"},
 }
 
@@ -72,3 +107,29 @@ func BenchmarkParse(b *testing.B) {
 		b.Error(err)
 	}
 }
+
+var parseMustacheTests = []parseTest{
+	{"raw", "{{{a}}}{{& a.b }}", noError, ""},
+	{"implicit-iterator", "{{#.}}{{.}}{{/.}}", noError, ""},
+	{"set-delimiters", "{{=<% %>=}}<%a%><%={{ }}=%>{{a}}", noError, ""},
+	{"standalone-partial", "  {{>a}}\n", noError, ""},
+	{"empty-raw", "{{&}}", hasError, "empty-raw:1: unexpected token: }}"},
+	{"unclosed-raw", "{{{a}}", hasError, "unclosed-raw:1: unrecognized character in tag: U+007D '}'"},
+	{"invalid-delimiters", "{{=a=}}", hasError, `invalid-delimiters:1: invalid delimiters: "a"`},
+}
+
+func TestParseMustache(t *testing.T) {
+	for _, test := range parseMustacheTests {
+		_, err := ParseOptions(test.name, MustacheOptions(), test.input)
+
+		if err != nil && test.ok {
+			t.Errorf("%q: unexpected error: %v", test.name, err)
+		} else if err != nil && !test.ok {
+			if result := err.Error(); result != test.result {
+				t.Errorf("%s=(%q): got\n\t%v\nexpected\n\t%v", test.name, test.input, result, test.result)
+			}
+		} else if err == nil && !test.ok {
+			t.Errorf("%q: expected error; got none", test.name)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package template
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// printer writes nodes back as template source.
+type printer struct {
+	w          io.Writer
+	leftDelim  string
+	rightDelim string
+	err        error
+}
+
+// Print writes the canonical template source of node to w. Tags are
+// written without padding, arguments are separated by a single space and
+// text and comments are written as they are. Empty delimiters default
+// to "((" and "))". The whitespace around standalone tags in Mustache
+// templates is not part of the tree and is not written.
+func Print(w io.Writer, node Node, left, right string) error {
+	if left == "" {
+		left = leftDelim
+	}
+	if right == "" {
+		right = rightDelim
+	}
+
+	p := &printer{w: w, leftDelim: left, rightDelim: right}
+	p.print(node)
+
+	return p.err
+}
+
+// Format parses src with the delimiters and syntax of options and
+// returns it in canonical form, written with the same delimiters. The
+// whitespace around standalone Mustache tags is kept.
+func Format(name string, options *Options, src []byte) ([]byte, error) {
+	if options == nil {
+		options = &Options{}
+	}
+
+	n, err := parseSource(name, options, string(src), true)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := Print(&buf, n, options.LeftDelim, options.RightDelim); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (p *printer) write(s ...string) {
+	for _, v := range s {
+		if p.err != nil {
+			return
+		}
+		_, p.err = io.WriteString(p.w, v)
+	}
+}
+
+func (p *printer) tag(typ, body string) {
+	p.write(p.leftDelim, typ, body, p.rightDelim)
+}
+
+func (p *printer) children(nodes []Node) {
+	for _, n := range nodes {
+		p.print(n)
+	}
+}
+
+// section writes the children and the else branch of a section. A
+// chained section is written as part of the else tag before it.
+func (p *printer) section(n *sectionNode) {
+	p.children(n.Children())
+	if n.Else == nil {
+		return
+	}
+
+	if c, ok := chained(n.Else); ok {
+		typ := "#"
+		if c.Inverted {
+			typ = "^"
+		}
+		p.tag("", "else "+typ+expressionString(c.Head, c.Tail))
+		p.section(c)
+		return
+	}
+
+	if n.PushMap {
+		// Mustache has no else keyword; PushMap is only set there.
+		p.tag("^", "")
+	} else {
+		p.tag("", "else")
+	}
+	p.children(n.Else.Children())
+}
+
+// chained returns the section of an else branch that was opened by a
+// chained else tag, like ((else #b)).
+func chained(l *listNode) (*sectionNode, bool) {
+	if len(l.children) != 1 {
+		return nil, false
+	}
+	s, ok := l.children[0].(*sectionNode)
+	return s, ok && s.Chained
+}
+
+func (p *printer) print(node Node) {
+	switch n := node.(type) {
+	case *listNode:
+		p.children(n.Children())
+	case *textNode:
+		p.write(n.Text)
+	case *commentNode:
+		if !n.Delims {
+			p.tag("!", n.Text)
+			break
+		}
+
+		// The tags that follow are written with the new delimiters.
+		delims := strings.Fields(strings.Trim(n.Text, "="))
+		p.tag("", "="+strings.Join(delims, " ")+"=")
+		if len(delims) == 2 {
+			p.leftDelim, p.rightDelim = delims[0], delims[1]
+		}
+	case *variableNode:
+		typ := ""
+		if n.Raw {
+			typ = "&"
+		}
+
+		expr := expressionString(n.Head, n.Tail)
+		if typ == "" && strings.HasPrefix(expr, "!") {
+			// Otherwise it would be read as a comment.
+			expr = "(" + expr + ")"
+		}
+
+		p.tag(typ, expr)
+	case *sectionNode:
+		typ := "#"
+		if n.Inverted {
+			typ = "^"
+		}
+
+		p.tag(typ, expressionString(n.Head, n.Tail))
+		p.section(n)
+		p.tag("/", n.Name())
+	case *letNode:
+		p.tag("", "let "+n.Name()+" = "+expressionString(n.Head, n.Tail))
+	case *partialNode:
+		p.write(n.Indent)
+		p.tag(">", partialString(n))
+	case *inheritNode:
+		p.tag("<", n.Name())
+		p.children(n.Children())
+		p.tag("/", n.Name())
+	case *defineNode:
+		p.tag("$", n.Name())
+		p.children(n.Children())
+		p.tag("/", n.Name())
+	default:
+		if p.err == nil {
+			p.err = fmt.Errorf("template: cannot print node of type %T", node)
+		}
+	}
+}
+
+// expressionString returns the source of an expression.
+func expressionString(head Node, tail []Node) string {
+	var buf bytes.Buffer
+
+	if _, ok := head.(*callNode); ok {
+		// Otherwise it would be read as the name of a section.
+		buf.WriteString("(" + argString(head) + ")")
+	} else {
+		buf.WriteString(argString(head))
+	}
+	for _, n := range tail {
+		buf.WriteByte(' ')
+		buf.WriteString(nestedArgString(n))
+	}
+
+	return buf.String()
+}
+
+// partialString returns the source of the name and the arguments of a
+// partial.
+func partialString(n *partialNode) string {
+	var buf bytes.Buffer
+	buf.WriteString(n.Name())
+
+	if n.Context != nil {
+		buf.WriteString(" " + nestedArgString(n.Context))
+	}
+	for _, p := range n.Params {
+		buf.WriteString(" " + p.Key + "=" + nestedArgString(p.Value))
+	}
+
+	return buf.String()
+}
+
+// argString returns the source of a single argument of an expression.
+func argString(node Node) string {
+	switch n := node.(type) {
+	case *identifierNode:
+		return n.Name()
+	case *stringNode:
+		return n.Quoted
+	case *numberNode:
+		return n.Text
+	case *boolNode:
+		return strconv.FormatBool(n.True)
+	case *nilNode:
+		return "nil"
+	case *sliceNode:
+		items := make([]string, len(n.Items))
+		for i, item := range n.Items {
+			items[i] = nestedArgString(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case *mapNode:
+		entries := make([]string, len(n.Keys))
+		for i, key := range n.Keys {
+			entries[i] = keyString(key) + ": " + nestedArgString(n.Values[i])
+		}
+		return "{" + strings.Join(entries, ", ") + "}"
+	case *binaryNode:
+		prec := binaryPrecedence[n.Op]
+		return operandString(n.Left, prec) + " " + n.Op + " " + operandString(n.Right, prec+1)
+	case *unaryNode:
+		return n.Op + operandString(n.Operand, unaryPrecedence)
+	case *callNode:
+		return expressionString(n.Func, n.Args)
+	}
+
+	return ""
+}
+
+// nestedArgString returns the source of an argument of a call, a partial
+// or a literal, in parentheses if it's an expression with operators or a
+// call.
+func nestedArgString(node Node) string {
+	switch node.(type) {
+	case *binaryNode, *unaryNode, *callNode:
+		return "(" + argString(node) + ")"
+	}
+	return argString(node)
+}
+
+// keyString returns the source of a key in a map literal, which is
+// quoted unless it's a plain name.
+func keyString(key string) string {
+	if key == "" {
+		return `""`
+	}
+	for i, r := range key {
+		if !isAlphaNumeric(r) || i == 0 && !isAlpha(r) {
+			return strconv.Quote(key)
+		}
+	}
+	return key
+}
+
+// operandString returns the source of an operand, in parentheses if
+// it's a binary operator that binds less tightly than minPrec.
+func operandString(node Node, minPrec int) string {
+	if b, ok := node.(*binaryNode); ok && binaryPrecedence[b.Op] < minPrec {
+		return "(" + argString(node) + ")"
+	}
+	return argString(node)
+}
@@ -0,0 +1,163 @@
+package template
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// clearPos sets the position of node and all its descendants to zero,
+// so that trees parsed from differently formatted input can be compared.
+func clearPos(node Node) {
+	clearPosValue(reflect.ValueOf(node))
+}
+
+func clearPosValue(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if !v.IsNil() {
+			clearPosValue(v.Elem())
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Field(i); f.Type() == reflect.TypeOf(Pos(0)) {
+				reflect.NewAt(f.Type(), f.Addr().UnsafePointer()).Elem().SetInt(0)
+			} else {
+				clearPosValue(f)
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			clearPosValue(v.Index(i))
+		}
+	case reflect.Map:
+		for _, k := range v.MapKeys() {
+			clearPosValue(v.MapIndex(k))
+		}
+	}
+}
+
+var printTests = []struct {
+	name   string
+	input  string
+	result string
+}{
+	{"empty", "", ""},
+	{"text", "now is the time", "now is the time"},
+	{"variable", `(( test  1 "two"   3.14 ))`, `((test 1 "two" 3.14))`},
+	{"fields", `((  a.b.c ))`, `((a.b.c))`},
+	{"section", "((# test x ))a((/ test ))", "((#test x))a((/test))"},
+	{"inverted-section", "((^ test))a((/ test))", "((^test))a((/test))"},
+	{"comment", "((!  keep  this ))", "((!  keep  this ))"},
+	{"parent", "((# ../../a.b ..))((/../../a.b))", "((#../../a.b ..))((/../../a.b))"},
+	{"index", `((# a[0].b["c d"][-1] ))((/a[0].b["c d"][-1]))`, `((#a[0].b["c d"][-1]))((/a[0].b["c d"][-1]))`},
+	{"partial", "((> one.two ))", "((>one.two))"},
+	{"dynamic-partial", "((> * one.two ))", "((>*one.two))"},
+	{"partial-args", `((> card   item  title="Sale"  n=1 ))`, `((>card item title="Sale" n=1))`},
+	{"inherit", "((< base ))\n(($ title ))x((/ title))\n((/base))", "((<base))\n(($title))x((/title))\n((/base))"},
+	{"operators", "((#a>1&&!( b||c ) ))x((/ ))((-(a+b)*c ?? d-1))", "((#a > 1 && !(b || c)))x((/))((-(a + b) * c ?? d - 1))"},
+	{"negation", "(((!a)&&b ))((#!a))((/))((!  c ))((!note))((f (-1) ( -x) -2 x-2))", "(((!a && b)))((#!a))((/))((!  c ))((!note))((f -1 (-x) -2 x - 2))"},
+	{"operator-call", `((#( f x ) ))((/))((f x=="y"))`, `((#(f x)))((/))((f x == "y"))`},
+	{"literals", `((f  [ 1,"a" , b ,] {a:1, "b c":nil, "d-e" : [true]} ))((> p {} x=[]))`, `((f [1, "a", b] {a: 1, "b c": nil, "d-e": [true]}))((>p {} x=[]))`},
+	{"else", "((#a))x(( else #b ))y((else ^ c))z((else))w((/a))((^d))((^))v((/d))((#e))((else))((#f))((/f))((/e))", "((#a))x((else #b))y((else ^c))z((else))w((/a))((^d))((else))v((/d))((#e))((else))((#f))((/f))((/e))"},
+	{"let", "((let  x=a.b  1 ))((let y = (f x) ))", "((let x = a.b 1))((let y = (f x)))"},
+	{"raw-string", "((a `b\n\\c` ))", "((a `b\n\\c`))"},
+	{"escaped-string", `((a "b \"c\""))`, `((a "b \"c\""))`},
+}
+
+func TestPrint(t *testing.T) {
+	for _, test := range printTests {
+		n, err := Parse(test.name, "", "", test.input)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		var buf bytes.Buffer
+		if err := Print(&buf, n, "", ""); err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+			continue
+		}
+
+		if result := buf.String(); result != test.result {
+			t.Errorf("%s: got\n\t%q\nexpected\n\t%q", test.name, result, test.result)
+		}
+	}
+}
+
+func TestPrintRoundTrip(t *testing.T) {
+	inputs := append([]string{benchmarkParseTmpl}, func() (s []string) {
+		for _, test := range printTests {
+			s = append(s, test.input)
+		}
+		return
+	}()...)
+
+	for _, input := range inputs {
+		n1, err := Parse("round-trip", "", "", input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		if err := Print(&buf, n1, "", ""); err != nil {
+			t.Fatal(err)
+		}
+
+		n2, err := Parse("round-trip", "", "", buf.String())
+		if err != nil {
+			t.Fatalf("%q: %v", buf.String(), err)
+		}
+
+		clearPos(n1)
+		clearPos(n2)
+		if !reflect.DeepEqual(n1, n2) {
+			t.Errorf("%q: tree changed after printing as\n\t%q", input, buf.String())
+		}
+	}
+}
+
+func TestFormatDelims(t *testing.T) {
+	b, err := Format("delims", &Options{LeftDelim: "$$", RightDelim: "@@"}, []byte("$$# a @@$$ b@@$$/a@@"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r := string(b); r != "$$#a@@$$b@@$$/a@@" {
+		t.Errorf("got %q", r)
+	}
+}
+
+func TestFormatKebabCase(t *testing.T) {
+	src := "((created-at))((#a-b))((c - 1))((/a-b))"
+	b, err := Format("kebab", &Options{KebabCase: true}, []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r := string(b); r != src {
+		t.Errorf("got %q, expected %q", r, src)
+	}
+}
+
+func TestFormatMustache(t *testing.T) {
+	tests := []struct {
+		input  string
+		result string
+	}{
+		{"a\n  {{#b}}  \n  {{>c}}\n{{/b}}\n{{! d }}\r\nz", "a\n  {{#b}}  \n  {{>c}}\n{{/b}}\n{{! d }}\r\nz"},
+		{"{{= <% %> =}}<% a %> <%={{ }}=%>{{b}}", "{{=<% %>=}}<%a%> <%={{ }}=%>{{b}}"},
+		{"{{{ x }}} {{& y}} {{#a}}{{^}}b{{/a}}", "{{&x}} {{&y}} {{#a}}{{^}}b{{/a}}"},
+	}
+
+	for _, test := range tests {
+		b, err := Format("mustache", MustacheOptions(), []byte(test.input))
+		if err != nil {
+			t.Errorf("%q: %v", test.input, err)
+			continue
+		}
+		if r := string(b); r != test.result {
+			t.Errorf("%q: got %q, expected %q", test.input, r, test.result)
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package template
+
+import (
+	"errors"
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// ReloadStorage is a NodeStorage that keeps the templates in a file
+// system up to date. Files are polled for changes in their modification
+// time and size, which is meant for development, not production.
+//
+// A file that fails to parse keeps its last good version, and the
+// error is available through Errors until the file is fixed. A file that
+// fails to parse when the storage is created has no template at all.
+// Load returns the parse error of a template without a good version, or
+// the error of the last reload if the file system could not be read.
+type ReloadStorage struct {
+	mu        sync.RWMutex
+	m         map[string]Node
+	files     map[string]fileStamp // By file name.
+	errs      map[string]error     // By file name.
+	names     map[string]string    // Template name to the file it was parsed from.
+	err       error                // Error of the last reload.
+	options   *Options
+	fsys      fs.FS
+	patterns  []string
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// fileStamp identifies a version of a file.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewReloadStorage loads the files in fsys that match the patterns, like
+// ParseFS does. If interval is larger than zero, the files are checked for
+// changes at that interval until Close is called. Otherwise they are only
+// checked when Reload is called.
+func NewReloadStorage(options *Options, fsys fs.FS, interval time.Duration, patterns ...string) (*ReloadStorage, error) {
+	if options == nil {
+		options = &Options{}
+	}
+
+	r := &ReloadStorage{
+		m:        make(map[string]Node),
+		files:    make(map[string]fileStamp),
+		errs:     make(map[string]error),
+		names:    make(map[string]string),
+		options:  options,
+		fsys:     fsys,
+		patterns: patterns,
+	}
+
+	if _, err := globFS(fsys, patterns); err != nil {
+		return nil, err
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	if interval > 0 {
+		r.stop = make(chan struct{})
+		r.done = make(chan struct{})
+		go r.poll(interval)
+	}
+
+	return r, nil
+}
+
+func (r *ReloadStorage) poll(interval time.Duration) {
+	defer close(r.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.Reload() // The error is kept for Load.
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// Close stops polling for changes. It can be called more than once.
+func (r *ReloadStorage) Close() {
+	r.closeOnce.Do(func() {
+		if r.stop != nil {
+			close(r.stop)
+			<-r.done
+		}
+	})
+}
+
+func (r *ReloadStorage) Get(name string) (Node, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	n, ok := r.m[name]
+	return n, ok
+}
+
+// Load returns the template name, or an error that explains why it
+// isn't available.
+func (r *ReloadStorage) Load(name string) (Node, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if n, ok := r.m[name]; ok {
+		return n, nil
+	}
+
+	for fn, err := range r.errs {
+		if templateName(r.options, fn) == name {
+			return nil, err
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return nil, errNoTemplate
+}
+
+// Snapshot returns a read-only view of the templates as they are now.
+func (r *ReloadStorage) Snapshot() NodeStorage {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	m := make(nodeSnapshot, len(r.m))
+	for name, n := range r.m {
+		m[name] = n
+	}
+
+	return reloadSnapshot{m, r}
+}
+
+// reloadSnapshot is a snapshot of a ReloadStorage. Templates
+// that are missing are explained by the storage.
+type reloadSnapshot struct {
+	nodeSnapshot
+	r *ReloadStorage
+}
+
+func (s reloadSnapshot) Load(name string) (Node, error) {
+	if n, ok := s.nodeSnapshot[name]; ok {
+		return n, nil
+	}
+	if _, err := s.r.Load(name); err != nil {
+		return nil, err
+	}
+	return nil, errNoTemplate
+}
+
+func (r *ReloadStorage) Set(name string, n Node) {
+	r.mu.Lock()
+	r.m[name] = n
+	r.mu.Unlock()
+}
+
+// Errors returns the parse errors of the files that currently
+// fail to parse, by file name.
+func (r *ReloadStorage) Errors() map[string]error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	errs := make(map[string]error, len(r.errs))
+	for fn, err := range r.errs {
+		errs[fn] = err
+	}
+
+	return errs
+}
+
+// Reload parses the files that were added or changed since the last
+// call and removes the templates of files that were deleted. Parse
+// errors are not returned, but recorded for Errors. The error that
+// is returned is that of reading the file system, which Load returns
+// for missing templates until the next reload.
+func (r *ReloadStorage) Reload() error {
+	err := r.reload()
+
+	r.mu.Lock()
+	r.err = err
+	r.mu.Unlock()
+
+	return err
+}
+
+func (r *ReloadStorage) reload() error {
+	filenames, _, err := matchFS(r.fsys, r.patterns)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool, len(filenames))
+	for _, fn := range filenames {
+		seen[fn] = true
+	}
+
+	r.mu.Lock()
+	for fn := range r.files {
+		if seen[fn] {
+			continue
+		}
+
+		name := templateName(r.options, fn)
+		delete(r.files, fn)
+		delete(r.errs, fn)
+		if r.names[name] != fn {
+			// Another file provides the template.
+			continue
+		}
+
+		delete(r.m, name)
+		delete(r.names, name)
+		for _, other := range filenames {
+			if templateName(r.options, other) == name {
+				// Parse the other file with the same name again.
+				delete(r.files, other)
+			}
+		}
+	}
+	r.mu.Unlock()
+
+	var errs []error
+
+	for _, fn := range filenames {
+
+		info, err := fs.Stat(r.fsys, fn)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		stamp := fileStamp{info.ModTime(), info.Size()}
+
+		r.mu.RLock()
+		old, ok := r.files[fn]
+		r.mu.RUnlock()
+
+		if ok && old == stamp {
+			continue
+		}
+
+		b, err := fs.ReadFile(r.fsys, fn)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		n, err := ParseOptions(fn, r.options, string(b))
+
+		r.mu.Lock()
+		r.files[fn] = stamp
+		if err != nil {
+			r.errs[fn] = err
+		} else {
+			delete(r.errs, fn)
+			name := templateName(r.options, fn)
+			r.m[name] = n
+			r.names[name] = fn
+		}
+		r.mu.Unlock()
+	}
+
+	return errors.Join(errs...)
+}
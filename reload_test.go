@@ -0,0 +1,215 @@
+package template
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestReloadStorage(t *testing.T) {
+	start := time.Now()
+	fsys := fstest.MapFS{
+		"page.html": {Data: []byte("v1 ((>part))"), ModTime: start},
+		"part.html": {Data: []byte("part"), ModTime: start},
+	}
+
+	r, err := NewReloadStorage(&Options{StripExtension: true}, fsys, 0, "*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	tmpl := New(r)
+	render := func() string {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, "page", nil); err != nil {
+			return err.Error()
+		}
+		return buf.String()
+	}
+
+	if s := render(); s != "v1 part" {
+		t.Fatalf("got %q", s)
+	}
+
+	// Changed file.
+	fsys["page.html"] = &fstest.MapFile{Data: []byte("v2 ((>part))"), ModTime: start.Add(time.Second)}
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if s := render(); s != "v2 part" {
+		t.Errorf("got %q", s)
+	}
+
+	// Parse error keeps the last good version.
+	fsys["page.html"] = &fstest.MapFile{Data: []byte("v3 ((#x))"), ModTime: start.Add(2 * time.Second)}
+	r.Reload()
+	if s := render(); s != "v2 part" {
+		t.Errorf("got %q", s)
+	}
+	if errs := r.Errors(); errs["page.html"] == nil {
+		t.Errorf("expected error for page.html; got %v", errs)
+	}
+
+	// Fixed file clears the error.
+	fsys["page.html"] = &fstest.MapFile{Data: []byte("v4"), ModTime: start.Add(3 * time.Second)}
+	r.Reload()
+	if s := render(); s != "v4" {
+		t.Errorf("got %q", s)
+	}
+	if errs := r.Errors(); len(errs) != 0 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+
+	// Deleted file.
+	delete(fsys, "part.html")
+	r.Reload()
+	if _, ok := r.Get("part"); ok {
+		t.Error("deleted template still available")
+	}
+}
+
+func TestReloadStoragePoll(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "a")
+	if err := os.WriteFile(fn, []byte("1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := NewReloadStorage(nil, os.DirFS(dir), time.Millisecond, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if err := os.WriteFile(fn, []byte("22"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		n, _ := r.Get("a")
+		if text := n.(ParentNode).Children()[0].(*textNode).Text; text == "22" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("template was not reloaded")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestReloadStorageSameName(t *testing.T) {
+	start := time.Now()
+	fsys := fstest.MapFS{
+		"a.html": {Data: []byte("html"), ModTime: start},
+		"a.txt":  {Data: []byte("txt"), ModTime: start},
+	}
+
+	r, err := NewReloadStorage(&Options{StripExtension: true}, fsys, 0, "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := func() string {
+		n, ok := r.Get("a")
+		if !ok {
+			return "<missing>"
+		}
+		return n.(ParentNode).Children()[0].(*textNode).Text
+	}
+
+	steps := []struct {
+		change func()
+		text   string
+	}{
+		{func() {}, "txt"},
+		{func() { delete(fsys, "a.html") }, "txt"},
+		{func() { fsys["a.html"] = &fstest.MapFile{Data: []byte("html2"), ModTime: start.Add(time.Second)} }, "html2"},
+		{func() { delete(fsys, "a.html") }, "txt"},
+		{func() { delete(fsys, "a.txt") }, "<missing>"},
+	}
+
+	for i, step := range steps {
+		step.change()
+		if err := r.Reload(); err != nil {
+			t.Fatal(err)
+		}
+		if s := text(); s != step.text {
+			t.Errorf("#%d: got %q, expected %q", i, s, step.text)
+		}
+	}
+}
+
+// failFS is a file system that fails to open anything if fail is set.
+type failFS struct {
+	fs.FS
+	fail bool
+}
+
+func (f *failFS) Open(name string) (fs.File, error) {
+	if f.fail {
+		return nil, errors.New("disk on fire")
+	}
+	return f.FS.Open(name)
+}
+
+func TestReloadStorageLoad(t *testing.T) {
+	files := fstest.MapFS{
+		"page.html": {Data: []byte("page")},
+		"bad.html":  {Data: []byte("((#x))")},
+	}
+	fsys := &failFS{FS: files}
+
+	r, err := NewReloadStorage(&Options{StripExtension: true}, fsys, 0, "*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	r.Close()
+
+	tmpl := New(r)
+	var buf bytes.Buffer
+
+	err = tmpl.Execute(&buf, "bad", nil)
+	if err == nil || err.Error() != "template not available: bad: bad.html:1: tag not closed" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	err = tmpl.Execute(&buf, "missing", nil)
+	if err == nil || err.Error() != "template not available: missing: no such template" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	snapshot := r.Snapshot()
+
+	fsys.fail = true
+	if err := r.Reload(); err == nil {
+		t.Fatal("expected an error")
+	}
+	if _, err := r.Load("page"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := r.Load("missing"); err == nil || err.Error() != "disk on fire" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	fsys.fail = false
+	files["page.html"] = &fstest.MapFile{Data: []byte("page2"), ModTime: time.Now().Add(time.Second)}
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	buf.Reset()
+	if err := New(snapshot).Execute(&buf, "page", nil); err != nil || buf.String() != "page" {
+		t.Errorf("snapshot changed: %q, %v", buf.String(), err)
+	}
+	buf.Reset()
+	if err := tmpl.Execute(&buf, "page", nil); err != nil || buf.String() != "page2" {
+		t.Errorf("got %q, %v", buf.String(), err)
+	}
+}
@@ -0,0 +1,151 @@
+package template
+
+import (
+	"errors"
+	"strings"
+)
+
+// errNoTemplate is returned by Load when a storage simply
+// doesn't have a template.
+var errNoTemplate = errors.New("no such template")
+
+// Overlay is a NodeStorage that looks up templates in each of its
+// storages in turn, so that earlier storages override later ones.
+// Templates are set in the first storage; Set panics if there is none.
+//
+// Partials and inherited templates are looked up through the whole
+// overlay as well, which means that a theme can override a single
+// partial and use everything else from a base storage:
+//
+//	New(Overlay{theme, base})
+type Overlay []NodeStorage
+
+func (o Overlay) Get(name string) (Node, bool) {
+	for _, nodes := range o {
+		if n, ok := nodes.Get(name); ok {
+			return n, true
+		}
+	}
+	return nil, false
+}
+
+func (o Overlay) Set(name string, n Node) {
+	if len(o) == 0 {
+		panic("template: cannot set " + name + " in an empty Overlay")
+	}
+	o[0].Set(name, n)
+}
+
+// Load returns the template name from the first storage that has it.
+// If none has it, the error is that of the first storage that can
+// tell why.
+func (o Overlay) Load(name string) (Node, error) {
+	var first error
+
+	for _, nodes := range o {
+		n, err := loadNode(nodes, name)
+		if err == nil {
+			return n, nil
+		}
+		if first == nil && err != errNoTemplate {
+			first = err
+		}
+	}
+
+	if first == nil {
+		first = errNoTemplate
+	}
+	return nil, first
+}
+
+// Snapshot returns an Overlay of snapshots of the storages
+// that support them.
+func (o Overlay) Snapshot() NodeStorage {
+	s := make(Overlay, len(o))
+	for i, nodes := range o {
+		s[i] = snapshot(nodes)
+	}
+	return s
+}
+
+// Mount is a NodeStorage that routes templates to storages by the prefix
+// of their name. The longest matching prefix is used and it is removed
+// from the name before it is passed to the storage. The empty prefix
+// matches every name. For example:
+//
+//	New(Mount{"": site, "admin/": admin, "mail:": mail})
+//
+// looks up "admin/users" as "users" in admin and "mail:welcome" as
+// "welcome" in mail. Set panics if no prefix matches the name.
+type Mount map[string]NodeStorage
+
+// route returns the storage for name and the name within that storage.
+func (m Mount) route(name string) (NodeStorage, string, bool) {
+	prefix, found := "", false
+
+	for p := range m {
+		if strings.HasPrefix(name, p) && (!found || len(p) > len(prefix)) {
+			prefix, found = p, true
+		}
+	}
+
+	if !found {
+		return nil, "", false
+	}
+
+	return m[prefix], name[len(prefix):], true
+}
+
+func (m Mount) Get(name string) (Node, bool) {
+	if nodes, name, ok := m.route(name); ok {
+		return nodes.Get(name)
+	}
+	return nil, false
+}
+
+// Load returns the template name from the storage it's routed to.
+func (m Mount) Load(name string) (Node, error) {
+	nodes, rest, ok := m.route(name)
+	if !ok {
+		return nil, errors.New("no storage mounted for " + name)
+	}
+	return loadNode(nodes, rest)
+}
+
+func (m Mount) Set(name string, n Node) {
+	nodes, rest, ok := m.route(name)
+	if !ok {
+		panic("template: no storage mounted for " + name)
+	}
+	nodes.Set(rest, n)
+}
+
+// Snapshot returns a Mount of snapshots of the storages
+// that support them.
+func (m Mount) Snapshot() NodeStorage {
+	s := make(Mount, len(m))
+	for prefix, nodes := range m {
+		s[prefix] = snapshot(nodes)
+	}
+	return s
+}
+
+// loadNode returns the template name from nodes, with the reason
+// why it isn't available if nodes is a LoadingStorage.
+func loadNode(nodes NodeStorage, name string) (Node, error) {
+	if l, ok := nodes.(LoadingStorage); ok {
+		return l.Load(name)
+	}
+	if n, ok := nodes.Get(name); ok {
+		return n, nil
+	}
+	return nil, errNoTemplate
+}
+
+// snapshot returns a snapshot of nodes if it supports them.
+func snapshot(nodes NodeStorage) NodeStorage {
+	if s, ok := nodes.(SnapshotStorage); ok {
+		return s.Snapshot()
+	}
+	return nodes
+}
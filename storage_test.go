@@ -0,0 +1,110 @@
+package template
+
+import (
+	"bytes"
+	"testing"
+)
+
+func parseNodeMap(t *testing.T, sources map[string]string) *NodeMap {
+	return parseTemplates(t, sources).nodes.(*NodeMap)
+}
+
+func TestOverlay(t *testing.T) {
+	base := parseNodeMap(t, map[string]string{
+		"page":   "((<layout))(($body))body((/body))((/layout))",
+		"layout": "((>header))|(($body))((/body))",
+		"header": "base header",
+	})
+	theme := parseNodeMap(t, map[string]string{
+		"header": "theme header",
+	})
+
+	var buf bytes.Buffer
+	if err := New(Overlay{theme, base}).Execute(&buf, "page", nil); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "theme header|body" {
+		t.Errorf("got %q", buf.String())
+	}
+
+	buf.Reset()
+	if err := New(Overlay{base, theme}).Execute(&buf, "page", nil); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "base header|body" {
+		t.Errorf("got %q", buf.String())
+	}
+}
+
+func TestMount(t *testing.T) {
+	site := parseNodeMap(t, map[string]string{"index": "site ((>admin/users))"})
+	admin := parseNodeMap(t, map[string]string{"users": "admin"})
+	mail := parseNodeMap(t, map[string]string{"welcome": "mail"})
+
+	m := Mount{"": site, "admin/": admin, "mail:": mail}
+
+	tests := [][]string{
+		{"index", "site admin"},
+		{"admin/users", "admin"},
+		{"mail:welcome", "mail"},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := New(m).Execute(&buf, test[0], nil); err != nil {
+			t.Errorf("%s: %v", test[0], err)
+		} else if buf.String() != test[1] {
+			t.Errorf("%s: got %q, expected %q", test[0], buf.String(), test[1])
+		}
+	}
+
+	m.Set("mail:bye", newList(0))
+	if _, ok := mail.Get("bye"); !ok {
+		t.Error("template not set in mounted storage")
+	}
+
+	if _, ok := (Mount{"a/": site}).Get("index"); ok {
+		t.Error("unexpected template")
+	}
+}
+
+func TestStorageLoad(t *testing.T) {
+	base := parseNodeMap(t, map[string]string{"page": "base"})
+	lazy := NewLazyStorage(nil, LoaderFunc(func(name string) (string, error) {
+		if name == "broken" {
+			return "((#x))", nil
+		}
+		return "", errNoTemplate
+	}))
+
+	tests := []struct {
+		nodes NodeStorage
+		name  string
+		err   string
+	}{
+		{Overlay{lazy, base}, "page", ""},
+		{Overlay{base, lazy}, "broken", "broken:1: tag not closed"},
+		{Overlay{base, lazy}, "missing", "no such template"},
+		{Overlay{}, "page", "no such template"},
+		{Mount{"a/": Overlay{lazy, base}}, "a/broken", "broken:1: tag not closed"},
+		{Mount{"a/": base}, "a/page", ""},
+		{Mount{"a/": base}, "page", "no storage mounted for page"},
+	}
+
+	for _, test := range tests {
+		_, err := test.nodes.(LoadingStorage).Load(test.name)
+		if test.err == "" && err != nil || test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("%s: got error %v, expected %q", test.name, err, test.err)
+		}
+	}
+}
+
+func TestOverlaySetEmpty(t *testing.T) {
+	defer func() {
+		if r := recover(); r != "template: cannot set page in an empty Overlay" {
+			t.Errorf("unexpected panic: %v", r)
+		}
+	}()
+
+	Overlay{}.Set("page", newList(0))
+}
@@ -3,6 +3,9 @@ package template
 import (
 	"fmt"
 	"io"
+	"path"
+	"reflect"
+	"strings"
 )
 
 type NodeStorage interface {
@@ -10,43 +13,100 @@ type NodeStorage interface {
 	Set(string, Node)
 }
 
+// LoadingStorage is a NodeStorage that can tell why a template
+// is not available.
+type LoadingStorage interface {
+	NodeStorage
+
+	Load(string) (Node, error)
+}
+
+// SnapshotStorage is a NodeStorage that can provide a consistent view
+// of its templates. Each execution of a template uses a single snapshot,
+// so that templates that are replaced during an execution don't mix
+// with the old ones.
+type SnapshotStorage interface {
+	NodeStorage
+
+	Snapshot() NodeStorage
+}
+
 type Template struct {
-	nodes NodeStorage
+	nodes   NodeStorage
+	helpers map[string]BlockHelper
 }
 
 func New(n NodeStorage) *Template {
-	t := &Template{n}
+	t := &Template{nodes: n}
 	return t
 }
 
 func (t *Template) Execute(wr io.Writer, name string, data interface{}) error {
-	node, ok := t.nodes.Get(name)
+	nodes := snapshot(t.nodes)
+
+	node, err := getNode(nodes, name)
+	if err != nil {
+		return err
+	}
+
+	return t.execute(wr, nodes, name, node, data)
+}
+
+// getNode returns the template name from a storage.
+func getNode(nodes NodeStorage, name string) (Node, error) {
+	if l, ok := nodes.(LoadingStorage); ok {
+		n, err := l.Load(name)
+		if err != nil {
+			return nil, fmt.Errorf("template not available: %s: %v", name, err)
+		}
+		return n, nil
+	}
+
+	node, ok := nodes.Get(name)
 	if !ok {
-		return fmt.Errorf("template not available: %s", name)
+		return nil, fmt.Errorf("template not available: %s", name)
 	}
 
-	return t.execute(wr, node, data)
+	return node, nil
 }
 
-func (t *Template) execute(wr io.Writer, node Node, data interface{}) error {
-	// PrintNodes(node, 0)
+func (t *Template) execute(wr io.Writer, nodes NodeStorage, name string, node Node, data interface{}) error {
+	s := &state{t: t, nodes: nodes, wr: wr, name: name}
+	s.push(reflect.ValueOf(data))
 
-	switch n := node.(type) {
-	case (*listNode):
-		for _, n := range n.Children() {
-			t.execute(wr, n, data)
-		}
-	case (*textNode):
-		wr.Write([]byte(n.Text)) // Store text as bytes in nodes?
-	case (*partialNode):
-		if partial, ok := t.nodes.Get(n.Name()); !ok {
-			return fmt.Errorf("template not available: %s", n.Name())
-		} else {
-			t.execute(wr, partial, data)
-		}
-	default:
-		panic("unknown node")
+	return s.walk(node)
+}
+
+// resolveName returns the name of a template that is referenced as name
+// from the template from. Names are cleaned like paths and names that
+// start with "./" or "../" are relative to the directory of from. A
+// prefix that ends with a colon, such as "mail:" of a Mount, is kept
+// and relative names stay below it. Names cannot go above the root.
+func resolveName(from, name string) (string, error) {
+	if name == "" {
+		return name, nil
+	}
+
+	prefix, rest := splitPrefix(name)
+	if strings.HasPrefix(name, "./") || strings.HasPrefix(name, "../") {
+		prefix, rest = splitPrefix(from)
+		rest = path.Join(path.Dir(rest), name)
+	}
+
+	rest = path.Clean(rest)
+	if rest == ".." || strings.HasPrefix(rest, "../") {
+		return "", fmt.Errorf("template name %s in %s is outside the root", name, from)
 	}
 
-	return nil
+	return prefix + rest, nil
+}
+
+// splitPrefix splits name after its first colon, if that comes
+// before the first slash.
+func splitPrefix(name string) (prefix, rest string) {
+	i := strings.IndexByte(name, ':')
+	if i < 0 || strings.Contains(name[:i], "/") {
+		return "", name
+	}
+	return name[:i+1], name[i+1:]
 }
@@ -0,0 +1,60 @@
+package template
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestResolveName(t *testing.T) {
+	tests := []struct {
+		from, name, result string
+		ok                 bool
+	}{
+		{"page", "header", "header", true},
+		{"page", "./header", "header", true},
+		{"a/b/page", "./header", "a/b/header", true},
+		{"a/b/page", "../header", "a/header", true},
+		{"a/b/page", "../../layouts/./base", "layouts/base", true},
+		{"a/page", "../../base", "", false},
+		{"page", "../base", "", false},
+		{"a/page", "x/../y", "y", true},
+		{"a/page", "x/./y/", "x/y", true},
+		{"a/page", "x/../../y", "", false},
+		{"mail:welcome", "./footer", "mail:footer", true},
+		{"mail:a/welcome", "../footer", "mail:footer", true},
+		{"mail:welcome", "../footer", "", false},
+		{"page", "mail:a/../footer", "mail:footer", true},
+	}
+
+	for _, test := range tests {
+		r, err := resolveName(test.from, test.name)
+		if (err == nil) != test.ok {
+			t.Errorf("%q from %q: unexpected error: %v", test.name, test.from, err)
+		} else if r != test.result {
+			t.Errorf("%q from %q: got %q, expected %q", test.name, test.from, r, test.result)
+		}
+	}
+}
+
+func TestExecuteRelative(t *testing.T) {
+	tmpl := parseTemplates(t, map[string]string{
+		"pages/a/index":   "((< ../../layouts/base))(($body))((> ./sidebar))((/body))((/ ../../layouts/base))",
+		"pages/a/sidebar": "sidebar",
+		"layouts/base":    "<(($body))((/body))((> ./footer))>",
+		"layouts/footer":  "|footer",
+		"escape":          "((> ../x))",
+	})
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, "pages/a/index", nil); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "<sidebar|footer>" {
+		t.Errorf("got %q", buf.String())
+	}
+
+	err := tmpl.Execute(&buf, "escape", nil)
+	if err == nil || err.Error() != "template: escape:@0: template name ../x in escape is outside the root" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}